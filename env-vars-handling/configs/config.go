@@ -1,18 +1,30 @@
 package configs
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 // Config is a struct that will receive configuration options via environment variables.
 type Config struct {
 	App struct {
-		Name     string `envconfig:"NAME"`
+		Name     string `envconfig:"NAME" validate:"required"`
 		URL      string `envconfig:"URL"`
 		Host     string `envconfig:"HOST"`
 		BasePath string `envconfig:"BASE_PATH"`
@@ -31,11 +43,11 @@ type Config struct {
 	DB struct {
 		MySQL struct {
 			Write struct {
-				Host     string `envconfig:"HOST"`
-				Port     string `envconfig:"PORT"`
-				Name     string `envconfig:"NAME"`
-				Username string `envconfig:"USER"`
-				Password string `envconfig:"PASSWORD"`
+				Host     string `envconfig:"HOST" validate:"required"`
+				Port     string `envconfig:"PORT" validate:"required"`
+				Name     string `envconfig:"NAME" validate:"required"`
+				Username string `envconfig:"USER" validate:"required"`
+				Password string `envconfig:"PASSWORD" secret:"true"`
 				Timezone string `envconfig:"TIMEZONE"`
 			} `envconfig:"WRITE"`
 			Read struct {
@@ -43,62 +55,483 @@ type Config struct {
 				Port     string `envconfig:"PORT"`
 				Name     string `envconfig:"NAME"`
 				Username string `envconfig:"USER"`
-				Password string `envconfig:"PASSWORD"`
+				Password string `envconfig:"PASSWORD" secret:"true"`
 				Timezone string `envconfig:"TIMEZONE"`
 			} `envconfig:"READ"`
 		} `envconfig:"MYSQL"`
 	} `envconfig:"DB"`
 
 	Server struct {
-		Env                   string `envconfig:"ENV"`
-		LogLevel              string `envconfig:"LOG_LEVEL"`
-		Port                  string `envconfig:"PORT"`
-		Host                  string `envconfig:"HOST"`
-		ShutdownCleanupPeriod int    `envconfig:"SHUTDOWN_CLEANUP_PERIOD_SECONDS"`
-		ShutdownGracePeriod   int    `envconfig:"SHUTDOWN_GRACE_PERIOD_SECONDS"`
+		Env      string `envconfig:"ENV"`
+		LogLevel string `envconfig:"LOG_LEVEL"`
+		Port     string `envconfig:"PORT" validate:"required"`
+		Host     string `envconfig:"HOST"`
+		// The shutdown periods are durations such as 30s or 1m30s, a bare number is seconds.
+		ShutdownCleanupPeriod Duration `envconfig:"SHUTDOWN_CLEANUP_PERIOD_SECONDS"`
+		ShutdownGracePeriod   Duration `envconfig:"SHUTDOWN_GRACE_PERIOD_SECONDS"`
+		// DefaultTimeout bounds operations that are not given a context, see Config.Context.
+		// It is a duration such as 5s, 0 disables it.
+		DefaultTimeout time.Duration `envconfig:"DEFAULT_TIMEOUT"`
 	} `envconfig:"SERVER"`
 }
 
+// Duration is a time.Duration read from a duration string such as 30s or 1m30s, or from
+// a bare integer, taken as seconds for the variables that used to be plain seconds.
+type Duration time.Duration
+
+// Decode implements envconfig.Decoder.
+func (d *Duration) Decode(value string) error {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected e.g. 15, 15s or 1m30s", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Duration returns d as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
 var (
-	conf        Config
-	once        sync.Once
-	initialized bool
+	// conf is the current snapshot, nil until Init succeeds. Reload swaps it atomically,
+	// so readers always see a complete config.
+	conf     atomic.Pointer[Config]
+	once     sync.Once
+	loadOpts Options
+	// initErr is the error of the first Init, returned again by every later call since
+	// once will not run it a second time.
+	initErr error
+	// envKeys are the variables set in the process environment before the env file was
+	// loaded. The file never overrides them, on Init or on Reload.
+	envKeys map[string]bool
+)
+
+const (
+	// DefaultEnvFile is the env file loaded when no other is given.
+	DefaultEnvFile = ".env"
+	// ConfigFileEnv names the variable holding the path of the env file to load, for when
+	// InitWithFile is not used.
+	ConfigFileEnv = "CONFIG_FILE"
 )
 
+// Options controls how environment values are transformed before they are processed.
+type Options struct {
+	// TrimSpace removes leading and trailing whitespace from config values.
+	TrimSpace bool
+	// ExpandEnv replaces ${VAR} and $VAR references in config values with their values.
+	ExpandEnv bool
+	// SplitWords derives the env name of a field without an envconfig tag from its camelCase
+	// name split on word boundaries, e.g. App.BasePath is read from APP_BASE_PATH instead of
+	// APP_BASEPATH. An explicit envconfig tag always wins over the split name.
+	SplitWords bool
+	// File is the path of the optional env file loaded into the environment first. Empty
+	// means the path in CONFIG_FILE, or DefaultEnvFile.
+	File string
+}
+
+// envFile returns the path of the env file to load.
+func (o Options) envFile() string {
+	if o.File != "" {
+		return o.File
+	}
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		return path
+	}
+	return DefaultEnvFile
+}
+
 // Init initializes the configuration system
 func Init() error {
-	var err error
+	return InitWithOptions(Options{})
+}
+
+// InitWithFile initializes the configuration system, loading the env file at path, e.g.
+// /etc/myapp/prod.env, instead of .env. Like Init only the first call has any effect.
+func InitWithFile(path string) error {
+	return InitWithOptions(Options{File: path})
+}
+
+// InitWithOptions initializes the configuration system, transforming values per opts. It
+// returns the errors of Config.Validate when required fields are missing, on this and
+// every later call.
+func InitWithOptions(opts Options) error {
 	once.Do(func() {
-		// Load .env file if provided
-		err = godotenv.Load(".env")
-		if err != nil {
-			log.Warn().Err(err).Msg("Could not load .env file, continuing with existing environment variables")
+		// Load the env file if provided
+		envKeys = environKeys()
+		path := opts.envFile()
+		if err := godotenv.Load(path); err != nil {
+			log.Warn().Err(err).Str("file", path).Msg("Could not load env file, continuing with existing environment variables")
 		} else {
-			log.Info().Msg("Successfully loaded variables from .env file into environment")
+			log.Info().Str("file", path).Msg("Successfully loaded variables from env file into environment")
 		}
 
 		// Process environment variables into the config struct
-		err = envconfig.Process("", &conf)
+		loaded, err := Load(opts)
 		if err != nil {
 			log.Fatal().Err(err).Msg("Failed to process environment variables")
 		}
+		if initErr = loaded.Validate(); initErr != nil {
+			return
+		}
+		loadOpts = opts
+		conf.Store(loaded)
 
-		initialized = true
 		log.Info().Msg("Service configuration initialized successfully")
 	})
 
-	return err
+	return initErr
+}
+
+// Reload re-reads the env file and the environment into a new Config, with the options
+// given to Init, and swaps it in for the one returned by Get. Edits to the file are picked
+// up, except for the variables set in the process environment before Init, which win over
+// the file like they do on Init. If the new config cannot be processed or is invalid, the
+// current one is kept and the error returned.
+func Reload() error {
+	if envKeys == nil {
+		envKeys = environKeys()
+	}
+
+	path := loadOpts.envFile()
+	values, err := godotenv.Read(path)
+	if err != nil {
+		log.Warn().Err(err).Str("file", path).Msg("Could not reload env file, continuing with existing environment variables")
+	}
+	for key, value := range values {
+		if !envKeys[key] {
+			os.Setenv(key, value)
+		}
+	}
+
+	loaded, err := Load(loadOpts)
+	if err != nil {
+		return fmt.Errorf("failed to process environment variables: %w", err)
+	}
+	if err := loaded.Validate(); err != nil {
+		return err
+	}
+	conf.Store(loaded)
+
+	log.Info().Msg("Service configuration reloaded successfully")
+	return nil
+}
+
+// environKeys returns the names of the variables currently set in the process environment.
+func environKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		keys[key] = true
+	}
+	return keys
+}
+
+// WatchSignal calls Reload every time sig is received, until stop is called. Reload
+// errors are logged and the current config is kept.
+func WatchSignal(sig os.Signal) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				if err := Reload(); err != nil {
+					log.Error().Err(err).Msg("Failed to reload configuration, keeping the current one")
+				}
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+		<-stopped
+	}
 }
 
-// Get returns the configuration
+// Load processes the current environment into a new Config, transforming values per opts first.
+func Load(opts Options) (*Config, error) {
+	transformEnv(opts)
+
+	var c Config
+	if err := process("", &c, opts.SplitWords); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// process is envconfig.Process, with split_words:"true" added to every field of spec when
+// splitWords is set. envconfig only reads split_words from the struct tags, so spec is
+// processed through a copy of its type carrying the extra tag and converted back.
+func process(prefix string, spec interface{}, splitWords bool) error {
+	if !splitWords {
+		return envconfig.Process(prefix, spec)
+	}
+
+	target := reflect.ValueOf(spec)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Struct {
+		return envconfig.ErrInvalidSpecification
+	}
+
+	split := reflect.New(withSplitWords(target.Elem().Type()))
+	split.Elem().Set(target.Elem().Convert(split.Elem().Type()))
+	if err := envconfig.Process(prefix, split.Interface()); err != nil {
+		return err
+	}
+	target.Elem().Set(split.Elem().Convert(target.Elem().Type()))
+	return nil
+}
+
+// withSplitWords returns t with split_words:"true" added to the tag of every field, recursing
+// into nested anonymous structs. Named structs such as time.Time are kept as is, rebuilding
+// them would drop their methods.
+func withSplitWords(t reflect.Type) reflect.Type {
+	if t.Kind() != reflect.Struct {
+		return t
+	}
+
+	fields := make([]reflect.StructField, t.NumField())
+	for i := range fields {
+		f := t.Field(i)
+		if !f.IsExported() {
+			// reflect.StructOf cannot build unexported fields, envconfig ignores them anyway
+			return t
+		}
+		if f.Type.Kind() == reflect.Struct && f.Type.Name() == "" {
+			f.Type = withSplitWords(f.Type)
+		}
+		if _, ok := f.Tag.Lookup("split_words"); !ok {
+			f.Tag = reflect.StructTag(strings.TrimSpace(string(f.Tag) + ` split_words:"true"`))
+		}
+		fields[i] = f
+	}
+	return reflect.StructOf(fields)
+}
+
+// transformEnv rewrites the environment variables read by Config in place, since
+// envconfig reads straight from the environment. Unrelated variables are left alone.
+func transformEnv(opts Options) {
+	if !opts.TrimSpace && !opts.ExpandEnv {
+		return
+	}
+
+	prefixes := configPrefixes()
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !hasAnyPrefix(key, prefixes) {
+			continue
+		}
+
+		transformed := value
+		if opts.ExpandEnv {
+			transformed = os.ExpandEnv(transformed)
+		}
+		if opts.TrimSpace {
+			transformed = strings.TrimSpace(transformed)
+		}
+		if transformed != value {
+			os.Setenv(key, transformed)
+		}
+	}
+}
+
+// configPrefixes returns the env prefixes of the top level Config sections, e.g. APP_.
+func configPrefixes() []string {
+	t := reflect.TypeOf(Config{})
+	prefixes := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("envconfig"); tag != "" {
+			prefixes = append(prefixes, tag+"_")
+		}
+	}
+	return prefixes
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the current configuration snapshot. It is never modified, Reload swaps
+// in a new one instead.
 func Get() *Config {
 	// Ensure configuration is initialized
-	if !initialized {
+	if conf.Load() == nil {
 		if err := Init(); err != nil {
 			log.Fatal().Err(err).Msg("Failed to initialize configuration")
 		}
 	}
-	return &conf
+	c := conf.Load()
+	if c == nil {
+		log.Fatal().Msg("Configuration is not initialized")
+	}
+	return c
+}
+
+// Validate reports every field tagged validate:"required" that is empty, by the name
+// of its environment variable, e.g. DB_MYSQL_WRITE_HOST is required.
+func (c *Config) Validate() error {
+	return errors.Join(missingFields(reflect.ValueOf(*c), "")...)
+}
+
+// missingFields returns an error for each empty required field of v, a struct whose
+// variables are prefixed with prefix.
+func missingFields(v reflect.Value, prefix string) []error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("envconfig")
+		if name == "" {
+			name = strings.ToUpper(f.Name)
+		}
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		value := v.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type.Name() == "" {
+			errs = append(errs, missingFields(value, name)...)
+			continue
+		}
+		if f.Tag.Get("validate") == "required" && value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	return errs
+}
+
+// Context returns the base context for operations that are not given one, expiring after
+// Server.DefaultTimeout. With no DefaultTimeout it is context.Background(), which never
+// expires. The cancel function must be called once the operation is done.
+func (c *Config) Context() (context.Context, context.CancelFunc) {
+	if c.Server.DefaultTimeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), c.Server.DefaultTimeout)
+}
+
+// WriteDSN returns the go-sql-driver/mysql DSN of the write database, e.g.
+// user:password@tcp(localhost:3306)/boiler?loc=Asia%2FJakarta&parseTime=true. Empty
+// optional parts are left out.
+func (c *Config) WriteDSN() string {
+	w := c.DB.MySQL.Write
+	return mysqlDSN(w.Username, w.Password, w.Host, w.Port, w.Name, w.Timezone)
+}
+
+// ReadDSN returns the DSN of the read database, see WriteDSN. Without DB_MYSQL_READ_HOST
+// there is no read replica and it returns WriteDSN.
+func (c *Config) ReadDSN() string {
+	r := c.DB.MySQL.Read
+	if r.Host == "" {
+		return c.WriteDSN()
+	}
+	return mysqlDSN(r.Username, r.Password, r.Host, r.Port, r.Name, r.Timezone)
+}
+
+// mysqlDSN formats a go-sql-driver/mysql DSN. The driver takes the password verbatim up to
+// the last @, so it is not URL-encoded, but the query parameters are.
+func mysqlDSN(user, password, host, port, name, timezone string) string {
+	var dsn strings.Builder
+	if user != "" {
+		dsn.WriteString(user)
+		if password != "" {
+			dsn.WriteString(":" + password)
+		}
+		dsn.WriteString("@")
+	}
+	if host != "" {
+		addr := host
+		if port != "" {
+			addr = net.JoinHostPort(host, port)
+		}
+		dsn.WriteString("tcp(" + addr + ")")
+	}
+	dsn.WriteString("/" + name)
+
+	params := url.Values{"parseTime": {"true"}}
+	if timezone != "" {
+		params.Set("loc", timezone)
+	}
+	dsn.WriteString("?" + params.Encode())
+	return dsn.String()
+}
+
+// redactedValue replaces the value of the fields tagged secret:"true" when it is set,
+// so logs show whether a secret is configured but not what it is.
+const redactedValue = "****"
+
+// String renders the config with every field tagged secret:"true" redacted, so printing
+// or logging the whole config does not leak credentials.
+func (c Config) String() string {
+	// the conversion drops the String method, which would recurse
+	type plain Config
+	return fmt.Sprintf("%+v", plain(c.redacted()))
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler, with every field tagged
+// secret:"true" redacted, e.g. log.Info().Object("config", cfg).
+func (c Config) MarshalZerologObject(e *zerolog.Event) {
+	marshalFields(e, reflect.ValueOf(c.redacted()))
+}
+
+// redacted returns a copy of c with its secret fields redacted.
+func (c Config) redacted() Config {
+	redactSecrets(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+func redactSecrets(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, value := t.Field(i), v.Field(i)
+		switch {
+		case f.Type.Kind() == reflect.Struct && f.Type.Name() == "":
+			redactSecrets(value)
+		case f.Tag.Get("secret") == "true" && f.Type.Kind() == reflect.String && value.Len() > 0:
+			value.SetString(redactedValue)
+		}
+	}
+}
+
+func marshalFields(e *zerolog.Event, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, value := t.Field(i), v.Field(i)
+		switch {
+		case f.Type.Kind() == reflect.Struct && f.Type.Name() == "":
+			dict := zerolog.Dict()
+			marshalFields(dict, value)
+			e.Dict(f.Name, dict)
+		case f.Type.Implements(reflect.TypeFor[fmt.Stringer]()):
+			e.Stringer(f.Name, value.Interface().(fmt.Stringer))
+		default:
+			e.Interface(f.Name, value.Interface())
+		}
+	}
 }
 
 // Debug prints out the current configuration
@@ -130,4 +563,7 @@ func (c *Config) Debug() {
 	fmt.Printf("  Log Level: %s\n", c.Server.LogLevel)
 	fmt.Printf("  Port: %s\n", c.Server.Port)
 	fmt.Printf("  Host: %s\n", c.Server.Host)
+	fmt.Printf("  Shutdown Cleanup Period: %v\n", c.Server.ShutdownCleanupPeriod)
+	fmt.Printf("  Shutdown Grace Period: %v\n", c.Server.ShutdownGracePeriod)
+	fmt.Printf("  Default Timeout: %v\n", c.Server.DefaultTimeout)
 }
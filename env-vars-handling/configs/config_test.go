@@ -0,0 +1,517 @@
+package configs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLoad_TrimSpace(t *testing.T) {
+	t.Setenv("APP_NAME", "  padded-app \t")
+
+	t.Run("disabled", func(t *testing.T) {
+		c, err := Load(Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.App.Name != "  padded-app \t" {
+			t.Fatalf("expected the value untouched, got %q", c.App.Name)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		c, err := Load(Options{TrimSpace: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.App.Name != "padded-app" {
+			t.Fatalf("expected the value trimmed, got %q", c.App.Name)
+		}
+	})
+}
+
+func TestLoad_ExpandEnv(t *testing.T) {
+	t.Setenv("BASE_DOMAIN", "example.com")
+	t.Setenv("APP_URL", "https://${BASE_DOMAIN}/app")
+	t.Setenv("APP_HOST", "api.$BASE_DOMAIN")
+
+	c, err := Load(Options{ExpandEnv: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.App.URL != "https://example.com/app" {
+		t.Errorf("expected ${...} to be expanded, got %q", c.App.URL)
+	}
+	if c.App.Host != "api.example.com" {
+		t.Errorf("expected $... to be expanded, got %q", c.App.Host)
+	}
+}
+
+func TestLoad_SplitWords(t *testing.T) {
+	var spec struct {
+		BasePath string
+		Legacy   string `envconfig:"LEGACY_NAME"`
+		CORS     struct {
+			MaxAgeSeconds int
+		}
+	}
+	t.Setenv("APP_BASE_PATH", "/split")
+	t.Setenv("APP_BASEPATH", "/joined")
+	t.Setenv("APP_LEGACY_NAME", "explicit")
+	t.Setenv("APP_CORS_MAX_AGE_SECONDS", "600")
+
+	t.Run("disabled", func(t *testing.T) {
+		if err := process("APP", &spec, false); err != nil {
+			t.Fatal(err)
+		}
+		if spec.BasePath != "/joined" {
+			t.Fatalf("expected APP_BASEPATH, got %q", spec.BasePath)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		if err := process("APP", &spec, true); err != nil {
+			t.Fatal(err)
+		}
+		if spec.BasePath != "/split" {
+			t.Errorf("expected APP_BASE_PATH, got %q", spec.BasePath)
+		}
+		if spec.CORS.MaxAgeSeconds != 600 {
+			t.Errorf("expected APP_CORS_MAX_AGE_SECONDS in a nested struct, got %d", spec.CORS.MaxAgeSeconds)
+		}
+		// the explicit tag wins over the split field name
+		if spec.Legacy != "explicit" {
+			t.Errorf("expected APP_LEGACY_NAME, got %q", spec.Legacy)
+		}
+	})
+
+	t.Run("config keeps its explicit tags", func(t *testing.T) {
+		t.Setenv("SERVER_SHUTDOWN_GRACE_PERIOD_SECONDS", "15")
+
+		c, err := Load(Options{SplitWords: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.App.BasePath != "/split" {
+			t.Errorf("expected APP_BASE_PATH, got %q", c.App.BasePath)
+		}
+		if c.Server.ShutdownGracePeriod.Duration() != 15*time.Second {
+			t.Errorf("expected SERVER_SHUTDOWN_GRACE_PERIOD_SECONDS, got %v", c.Server.ShutdownGracePeriod)
+		}
+	})
+}
+
+func TestLoad_ShutdownPeriods(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"15", 15 * time.Second},
+		{"15s", 15 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"500ms", 500 * time.Millisecond},
+	} {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("SERVER_SHUTDOWN_GRACE_PERIOD_SECONDS", tt.value)
+			t.Setenv("SERVER_SHUTDOWN_CLEANUP_PERIOD_SECONDS", tt.value)
+
+			c, err := Load(Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Server.ShutdownGracePeriod.Duration(); got != tt.want {
+				t.Errorf("expected grace period %v, got %v", tt.want, got)
+			}
+			if got := c.Server.ShutdownCleanupPeriod.Duration(); got != tt.want {
+				t.Errorf("expected cleanup period %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("SERVER_SHUTDOWN_GRACE_PERIOD_SECONDS", "soon")
+
+		if _, err := Load(Options{}); err == nil {
+			t.Fatal("expected an invalid duration to be rejected")
+		}
+	})
+}
+
+func TestConfig_Context(t *testing.T) {
+	t.Run("configured timeout", func(t *testing.T) {
+		t.Setenv("SERVER_DEFAULT_TIMEOUT", "5s")
+		c, err := Load(Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before := time.Now()
+		ctx, cancel := c.Context()
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("expected the context to have a deadline")
+		}
+		if d := deadline.Sub(before); d < 5*time.Second || d > 5*time.Second+time.Second {
+			t.Fatalf("expected a deadline about 5s away, got %v", d)
+		}
+
+		cancel()
+		if ctx.Err() == nil {
+			t.Fatal("expected cancel to cancel the context")
+		}
+	})
+
+	t.Run("zero timeout never expires", func(t *testing.T) {
+		var c Config
+		ctx, cancel := c.Context()
+		defer cancel()
+
+		if _, ok := ctx.Deadline(); ok {
+			t.Fatal("expected no deadline")
+		}
+		if ctx.Done() != nil {
+			t.Fatal("expected a context that is never done")
+		}
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	var c Config
+	c.App.Name = "orders"
+	c.DB.MySQL.Write.Host = "db.internal"
+	c.DB.MySQL.Write.Name = "orders"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected the missing fields to be reported")
+	}
+	want := "DB_MYSQL_WRITE_PORT is required\nDB_MYSQL_WRITE_USER is required\nSERVER_PORT is required"
+	if err.Error() != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, err)
+	}
+
+	c.DB.MySQL.Write.Port = "3306"
+	c.DB.MySQL.Write.Username = "orders"
+	c.Server.Port = "8080"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// setRequiredEnv sets every required variable, with APP_NAME set to name.
+func setRequiredEnv(t *testing.T, name string) {
+	t.Helper()
+	t.Setenv("APP_NAME", name)
+	t.Setenv("DB_MYSQL_WRITE_HOST", "db.internal")
+	t.Setenv("DB_MYSQL_WRITE_PORT", "3306")
+	t.Setenv("DB_MYSQL_WRITE_NAME", "orders")
+	t.Setenv("DB_MYSQL_WRITE_USER", "orders")
+	t.Setenv("SERVER_PORT", "8080")
+}
+
+// withConfig makes c the current config for the duration of the test.
+func withConfig(t *testing.T, c *Config) {
+	t.Helper()
+	prev := conf.Swap(c)
+	t.Cleanup(func() { conf.Store(prev) })
+}
+
+func TestReload(t *testing.T) {
+	setRequiredEnv(t, "orders")
+	initial, err := Load(Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	withConfig(t, initial)
+
+	t.Run("swaps in the new config", func(t *testing.T) {
+		t.Setenv("APP_NAME", "orders-v2")
+		before := Get()
+		if err := Reload(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := Get().App.Name; got != "orders-v2" {
+			t.Fatalf("expected APP_NAME orders-v2, got %q", got)
+		}
+		if before.App.Name != "orders" {
+			t.Fatalf("expected the previous snapshot to be left untouched, got %q", before.App.Name)
+		}
+	})
+
+	t.Run("keeps the current config when the new one is invalid", func(t *testing.T) {
+		current := Get()
+		t.Setenv("SERVER_PORT", "")
+		if err := Reload(); err == nil {
+			t.Fatal("expected the missing SERVER_PORT to be reported")
+		}
+		if Get() != current {
+			t.Fatal("expected the current config to be kept")
+		}
+	})
+}
+
+func TestWatchSignal(t *testing.T) {
+	setRequiredEnv(t, "orders")
+	initial, err := Load(Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	withConfig(t, initial)
+
+	stop := WatchSignal(syscall.SIGUSR1)
+	defer stop()
+
+	t.Setenv("APP_NAME", "orders-v2")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("failed to send signal: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for Get().App.Name != "orders-v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the config to be reloaded on SIGUSR1")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfig_RedactsSecrets(t *testing.T) {
+	var c Config
+	c.App.Name = "orders"
+	c.DB.MySQL.Write.Username = "orders"
+	c.DB.MySQL.Write.Password = "s3cr3t-write"
+	c.DB.MySQL.Read.Password = "s3cr3t-read"
+	c.Server.ShutdownGracePeriod = Duration(15 * time.Second)
+
+	t.Run("String", func(t *testing.T) {
+		for _, out := range []string{c.String(), fmt.Sprint(c), fmt.Sprintf("%v", &c), fmt.Sprintf("%+v", c)} {
+			if strings.Contains(out, "s3cr3t") {
+				t.Fatalf("expected the passwords to be redacted, got %s", out)
+			}
+			if !strings.Contains(out, "Password:****") || !strings.Contains(out, "Name:orders") {
+				t.Fatalf("expected the redacted config, got %s", out)
+			}
+		}
+	})
+
+	t.Run("zerolog", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf)
+		logger.Info().Object("config", c).Send()
+		if strings.Contains(buf.String(), "s3cr3t") {
+			t.Fatalf("expected the passwords to be redacted, got %s", buf.String())
+		}
+
+		var logged struct {
+			Config struct {
+				App struct{ Name string }
+				DB  struct {
+					MySQL struct {
+						Write, Read struct{ Password string }
+					}
+				}
+				Server struct{ ShutdownGracePeriod string }
+			} `json:"config"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+			t.Fatal(err)
+		}
+		if logged.Config.DB.MySQL.Write.Password != "****" || logged.Config.DB.MySQL.Read.Password != "****" {
+			t.Errorf("expected redacted passwords, got %s", buf.String())
+		}
+		if logged.Config.App.Name != "orders" || logged.Config.Server.ShutdownGracePeriod != "15s" {
+			t.Errorf("expected the other fields to be logged, got %s", buf.String())
+		}
+	})
+
+	t.Run("empty secrets stay empty", func(t *testing.T) {
+		var empty Config
+		if out := empty.String(); strings.Contains(out, "****") {
+			t.Fatalf("expected unset passwords to be shown as empty, got %s", out)
+		}
+	})
+
+	if c.DB.MySQL.Write.Password != "s3cr3t-write" {
+		t.Fatal("expected the config itself to keep its password")
+	}
+}
+
+func TestConfig_DSN(t *testing.T) {
+	var c Config
+	c.DB.MySQL.Write.Host = "db.internal"
+	c.DB.MySQL.Write.Port = "3306"
+	c.DB.MySQL.Write.Name = "orders"
+	c.DB.MySQL.Write.Username = "orders"
+	c.DB.MySQL.Write.Password = "p@ss:w/rd?&"
+	c.DB.MySQL.Write.Timezone = "Asia/Jakarta"
+
+	want := "orders:p@ss:w/rd?&@tcp(db.internal:3306)/orders?loc=Asia%2FJakarta&parseTime=true"
+	if got := c.WriteDSN(); got != want {
+		t.Errorf("expected write DSN\n%s\ngot\n%s", want, got)
+	}
+	if got := c.ReadDSN(); got != want {
+		t.Errorf("expected the read DSN to fall back to the write one, got %s", got)
+	}
+
+	c.DB.MySQL.Read.Host = "replica.internal"
+	c.DB.MySQL.Read.Name = "orders"
+	c.DB.MySQL.Read.Username = "reader"
+	want = "reader@tcp(replica.internal)/orders?parseTime=true"
+	if got := c.ReadDSN(); got != want {
+		t.Errorf("expected read DSN without the empty parts\n%s\ngot\n%s", want, got)
+	}
+
+	c.DB.MySQL.Read.Host = "::1"
+	c.DB.MySQL.Read.Port = "3307"
+	want = "reader@tcp([::1]:3307)/orders?parseTime=true"
+	if got := c.ReadDSN(); got != want {
+		t.Errorf("expected read DSN with an IPv6 host\n%s\ngot\n%s", want, got)
+	}
+}
+
+// resetInit lets Init run again for the duration of the test.
+func resetInit(t *testing.T) {
+	t.Helper()
+	prevConf, prevOpts, prevErr, prevKeys := conf.Load(), loadOpts, initErr, envKeys
+	once, loadOpts, initErr, envKeys = sync.Once{}, Options{}, nil, nil
+	conf.Store(nil)
+	t.Cleanup(func() {
+		once, loadOpts, initErr, envKeys = sync.Once{}, prevOpts, prevErr, prevKeys
+		conf.Store(prevConf)
+	})
+}
+
+// unsetEnv unsets key for the duration of the test, so an env file can set it.
+func unsetEnv(t *testing.T, key string) {
+	t.Helper()
+	// t.Setenv restores the variable afterwards, Unsetenv alone would leak
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func writeEnvFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prod.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInitWithFile(t *testing.T) {
+	t.Run("loads the given file", func(t *testing.T) {
+		resetInit(t)
+		setRequiredEnv(t, "orders")
+		unsetEnv(t, "APP_REVISION")
+		unsetEnv(t, ConfigFileEnv)
+		path := writeEnvFile(t, "APP_REVISION=v2.0.0\n")
+
+		if err := InitWithFile(path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := Get().App.Revision; got != "v2.0.0" {
+			t.Fatalf("expected APP_REVISION from %s, got %q", path, got)
+		}
+
+		// like Init, later calls are no-ops
+		other := writeEnvFile(t, "APP_REVISION=v3.0.0\n")
+		if err := InitWithFile(other); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := Get().App.Revision; got != "v2.0.0" {
+			t.Fatalf("expected the second call to be ignored, got %q", got)
+		}
+	})
+
+	t.Run("loads the file in CONFIG_FILE", func(t *testing.T) {
+		resetInit(t)
+		setRequiredEnv(t, "orders")
+		unsetEnv(t, "APP_REVISION")
+		t.Setenv(ConfigFileEnv, writeEnvFile(t, "APP_REVISION=v2.1.0\n"))
+
+		if err := Init(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := Get().App.Revision; got != "v2.1.0" {
+			t.Fatalf("expected APP_REVISION from CONFIG_FILE, got %q", got)
+		}
+	})
+
+	t.Run("continues without a missing file", func(t *testing.T) {
+		resetInit(t)
+		setRequiredEnv(t, "orders")
+
+		if err := InitWithFile(filepath.Join(t.TempDir(), "missing.env")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := Get().App.Name; got != "orders" {
+			t.Fatalf("expected the environment to be used, got APP_NAME %q", got)
+		}
+	})
+}
+
+func TestInit_ValidateErrorIsKept(t *testing.T) {
+	resetInit(t)
+	setRequiredEnv(t, "orders")
+	unsetEnv(t, "SERVER_PORT")
+	unsetEnv(t, ConfigFileEnv)
+
+	err := InitWithFile(filepath.Join(t.TempDir(), "missing.env"))
+	if err == nil || err.Error() != "SERVER_PORT is required" {
+		t.Fatalf("expected SERVER_PORT to be reported, got %v", err)
+	}
+
+	// once is used up, later calls must not report success with no config stored
+	t.Setenv("SERVER_PORT", "8080")
+	if err := Init(); err == nil || err.Error() != "SERVER_PORT is required" {
+		t.Fatalf("expected the first error again, got %v", err)
+	}
+	if c := conf.Load(); c != nil {
+		t.Fatalf("expected no config to be stored, got %v", c)
+	}
+}
+
+func TestReload_EnvironmentWinsOverFile(t *testing.T) {
+	resetInit(t)
+	setRequiredEnv(t, "orders")
+	unsetEnv(t, "APP_REVISION")
+	unsetEnv(t, ConfigFileEnv)
+	path := writeEnvFile(t, "SERVER_PORT=9999\nAPP_REVISION=v1.0.0\n")
+
+	if err := InitWithFile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := Get().Server.Port; got != "8080" {
+		t.Fatalf("expected SERVER_PORT from the environment, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("SERVER_PORT=9999\nAPP_REVISION=v2.0.0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the file still disagrees with the environment, the environment keeps winning
+	if got := Get().Server.Port; got != "8080" {
+		t.Fatalf("expected SERVER_PORT from the environment after reload, got %q", got)
+	}
+	if got := os.Getenv("SERVER_PORT"); got != "8080" {
+		t.Fatalf("expected the process environment to be left alone, got SERVER_PORT %q", got)
+	}
+	// values only the file sets are picked up
+	if got := Get().App.Revision; got != "v2.0.0" {
+		t.Fatalf("expected APP_REVISION from the edited file, got %q", got)
+	}
+}
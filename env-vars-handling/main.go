@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"os"
+	"syscall"
 
 	"github.com/azka-zaydan/article-materials/env-vars-handling/configs"
 	"github.com/rs/zerolog"
@@ -19,4 +21,27 @@ func main() {
 	config = configs.Get()
 
 	config.Debug()
+
+	opts := RunOptions{
+		ReloadSignals: []os.Signal{syscall.SIGHUP},
+		Reload:        reloadConfig,
+		GracePeriod:   config.Server.ShutdownGracePeriod.Duration(),
+	}
+	err := Run(context.Background(), opts, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Service stopped with an error")
+	}
+}
+
+// reloadConfig re-reads the environment into config.
+func reloadConfig() error {
+	if err := configs.Reload(); err != nil {
+		return err
+	}
+	config = configs.Get()
+	config.Debug()
+	return nil
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrShutdownTimeout is returned by Run when the service does not stop within the grace period.
+var ErrShutdownTimeout = errors.New("service did not stop within the shutdown grace period")
+
+// RunOptions controls which signals Run reacts to and how.
+type RunOptions struct {
+	// ShutdownSignals stop the service, they default to SIGINT and SIGTERM.
+	ShutdownSignals []os.Signal
+	// ReloadSignals call Reload instead of stopping the service, e.g. SIGHUP.
+	ReloadSignals []os.Signal
+	// Reload re-reads the configuration, errors are logged and the service keeps running.
+	Reload func() error
+	// GracePeriod bounds how long Run waits for the service to stop, 0 waits indefinitely.
+	GracePeriod time.Duration
+	// Signals, if set, is read instead of subscribing to the OS signals, e.g. in tests.
+	Signals <-chan os.Signal
+}
+
+func (o RunOptions) shutdownSignals() []os.Signal {
+	if len(o.ShutdownSignals) == 0 {
+		return []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	return o.ShutdownSignals
+}
+
+// Run runs serve until it returns or a shutdown signal arrives, in which case the context
+// passed to serve is cancelled and Run waits for serve to return.
+func Run(ctx context.Context, opts RunOptions, serve func(ctx context.Context) error) error {
+	shutdownSignals := opts.shutdownSignals()
+
+	signals := opts.Signals
+	if signals == nil {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, append(slices.Clone(shutdownSignals), opts.ReloadSignals...)...)
+		defer signal.Stop(ch)
+		signals = ch
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx) }()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return waitForShutdown(done, opts.GracePeriod)
+		case sig := <-signals:
+			switch {
+			case slices.Contains(opts.ReloadSignals, sig):
+				log.Info().Str("signal", sig.String()).Msg("Reloading configuration")
+				if opts.Reload == nil {
+					continue
+				}
+				if err := opts.Reload(); err != nil {
+					log.Error().Err(err).Msg("Failed to reload configuration, keeping the current one")
+				}
+			case slices.Contains(shutdownSignals, sig):
+				log.Info().Str("signal", sig.String()).Msg("Shutting down")
+				cancel()
+				return waitForShutdown(done, opts.GracePeriod)
+			}
+		}
+	}
+}
+
+func waitForShutdown(done <-chan error, gracePeriod time.Duration) error {
+	if gracePeriod <= 0 {
+		return <-done
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(gracePeriod):
+		return ErrShutdownTimeout
+	}
+}
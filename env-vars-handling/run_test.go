@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRun_ReloadAndShutdownSignals(t *testing.T) {
+	signals := make(chan os.Signal)
+	reloaded := make(chan struct{}, 1)
+	stopped := make(chan struct{})
+
+	opts := RunOptions{
+		ReloadSignals: []os.Signal{syscall.SIGHUP},
+		Reload: func() error {
+			reloaded <- struct{}{}
+			return nil
+		},
+		Signals: signals,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(context.Background(), opts, func(ctx context.Context) error {
+			<-ctx.Done()
+			close(stopped)
+			return nil
+		})
+	}()
+
+	signals <- syscall.SIGHUP
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("SIGHUP did not trigger a reload")
+	}
+	select {
+	case <-stopped:
+		t.Fatal("SIGHUP stopped the service")
+	default:
+	}
+
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SIGTERM did not shut the service down")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("service context was not cancelled")
+	}
+}
+
+func TestRun_CustomShutdownSignals(t *testing.T) {
+	signals := make(chan os.Signal, 2)
+	opts := RunOptions{
+		ShutdownSignals: []os.Signal{syscall.SIGINT},
+		Signals:         signals,
+	}
+
+	// SIGTERM is not in the set, so only the following SIGINT stops the service
+	signals <- syscall.SIGTERM
+	signals <- syscall.SIGINT
+
+	err := Run(context.Background(), opts, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if len(signals) != 0 {
+		t.Fatal("expected both signals to be consumed")
+	}
+}
+
+func TestRun_GracePeriodExceeded(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+	release := make(chan struct{})
+	defer close(release)
+
+	opts := RunOptions{GracePeriod: 20 * time.Millisecond, Signals: signals}
+	err := Run(context.Background(), opts, func(ctx context.Context) error {
+		// ignores the cancellation
+		<-release
+		return nil
+	})
+	if !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("expected ErrShutdownTimeout, got %v", err)
+	}
+}
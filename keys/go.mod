@@ -0,0 +1,3 @@
+module github.com/azka-zaydan/article-materials/keys
+
+go 1.22
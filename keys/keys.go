@@ -0,0 +1,85 @@
+// Package keys builds the Redis keys shared by the examples, so every key format
+// is defined in one place and cannot drift between call sites.
+package keys
+
+import "fmt"
+
+// Builder builds keys under an optional namespace.
+type Builder struct {
+	// Namespace is prepended to every key, separated by a colon, when it is not empty.
+	Namespace string
+}
+
+// Default is the builder used by the package level functions.
+var Default = Builder{}
+
+func (b Builder) build(format string, args ...any) string {
+	key := fmt.Sprintf(format, args...)
+	if b.Namespace == "" {
+		return key
+	}
+	return b.Namespace + ":" + key
+}
+
+// Product is the key a cached product is stored under.
+func (b Builder) Product(id int) string {
+	return b.build("product:%v", id)
+}
+
+// SingleflightProduct is the singleflight group key used to deduplicate product loads.
+func (b Builder) SingleflightProduct(id int) string {
+	return b.build("singleflight:product:%v", id)
+}
+
+// Singleflight is the singleflight group key deduplicating the reads of the cache key key.
+func (b Builder) Singleflight(key string) string {
+	return b.build("singleflight:%s", key)
+}
+
+// SingleflightLoad is the singleflight group key deduplicating the loads of the cache key
+// key on a miss. It differs from Singleflight, so a load never joins a plain read.
+func (b Builder) SingleflightLoad(key string) string {
+	return b.build("singleflight:load:%s", key)
+}
+
+// Lock is the key guarding an account. The account id is wrapped in a hash tag
+// so every key of the same account lands on the same Redis Cluster slot.
+func (b Builder) Lock(accountID string) string {
+	return b.build("add-account:{%s}", accountID)
+}
+
+// Balance is the key an account balance is stored under. It shares the hash tag of Lock,
+// so the balance and the lock guarding it land on the same Redis Cluster slot.
+func (b Builder) Balance(accountID string) string {
+	return b.build("balance:{%s}", accountID)
+}
+
+// ProductKey returns Default.Product(id).
+func ProductKey(id int) string {
+	return Default.Product(id)
+}
+
+// SingleflightProductKey returns Default.SingleflightProduct(id).
+func SingleflightProductKey(id int) string {
+	return Default.SingleflightProduct(id)
+}
+
+// SingleflightKey returns Default.Singleflight(key).
+func SingleflightKey(key string) string {
+	return Default.Singleflight(key)
+}
+
+// SingleflightLoadKey returns Default.SingleflightLoad(key).
+func SingleflightLoadKey(key string) string {
+	return Default.SingleflightLoad(key)
+}
+
+// LockKey returns Default.Lock(accountID).
+func LockKey(accountID string) string {
+	return Default.Lock(accountID)
+}
+
+// BalanceKey returns Default.Balance(accountID).
+func BalanceKey(accountID string) string {
+	return Default.Balance(accountID)
+}
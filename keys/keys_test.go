@@ -0,0 +1,52 @@
+package keys
+
+import "testing"
+
+func TestBuilders(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"product", ProductKey(1), "product:1"},
+		{"singleflight product", SingleflightProductKey(1), "singleflight:product:1"},
+		{"singleflight of the product key", SingleflightKey(ProductKey(1)), SingleflightProductKey(1)},
+		{"singleflight load", SingleflightLoadKey(ProductKey(1)), "singleflight:load:product:1"},
+		{"lock", LockKey("acc-1"), "add-account:{acc-1}"},
+		{"empty lock account", LockKey(""), "add-account:{}"},
+		{"balance", BalanceKey("acc-1"), "balance:{acc-1}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, tt.got)
+			}
+		})
+	}
+}
+
+func TestBuilders_Namespace(t *testing.T) {
+	b := Builder{Namespace: "shop"}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"product", b.Product(1), "shop:product:1"},
+		{"singleflight product", b.SingleflightProduct(1), "shop:singleflight:product:1"},
+		{"singleflight", b.Singleflight("product:1"), "shop:singleflight:product:1"},
+		{"singleflight load", b.SingleflightLoad("product:1"), "shop:singleflight:load:product:1"},
+		{"lock", b.Lock("acc-1"), "shop:add-account:{acc-1}"},
+		{"balance", b.Balance("acc-1"), "shop:balance:{acc-1}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, tt.got)
+			}
+		})
+	}
+}
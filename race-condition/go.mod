@@ -5,13 +5,19 @@ go 1.22
 toolchain go1.23.1
 
 require (
+	github.com/alicebob/miniredis/v2 v2.33.0
+	github.com/azka-zaydan/article-materials/keys v0.0.0
 	github.com/go-redsync/redsync/v4 v4.13.0
 	github.com/redis/go-redis/v9 v9.6.1
 )
 
 require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 )
+
+replace github.com/azka-zaydan/article-materials/keys => ../keys
@@ -0,0 +1,162 @@
+// Package lock provides a Redis backed distributed lock built on redsync, so any
+// example can guard a critical section across processes.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/go-redsync/redsync/v4/redis/goredis/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrLockLost is returned by release when the lock was no longer held, usually because
+// it expired while the critical section was still running.
+var ErrLockLost = errors.New("lock was lost before release")
+
+// ErrLockHeld is returned by TryAcquire when someone else holds the lock.
+var ErrLockHeld = errors.New("lock is held by someone else")
+
+// Options tune a single Acquire call. Zero values fall back to the redsync defaults.
+type Options struct {
+	// Expiry is how long the lock is held if it is never released.
+	Expiry time.Duration
+	// Tries is how many times the lock is attempted before giving up.
+	Tries int
+	// RetryDelay is the wait between two attempts.
+	RetryDelay time.Duration
+	// FailFast makes Acquire give up after a single attempt instead of waiting for the holder.
+	FailFast bool
+	// ExtendInterval starts a watchdog extending the lock at this interval until it is
+	// released, for critical sections that may outlive Expiry. It should be well below
+	// Expiry. 0 disables the watchdog.
+	ExtendInterval time.Duration
+}
+
+func (o Options) redsyncOptions() []redsync.Option {
+	var opts []redsync.Option
+	if o.Expiry > 0 {
+		opts = append(opts, redsync.WithExpiry(o.Expiry))
+	}
+	if o.FailFast {
+		opts = append(opts, redsync.WithTries(1))
+	} else if o.Tries > 0 {
+		opts = append(opts, redsync.WithTries(o.Tries))
+	}
+	if o.RetryDelay > 0 {
+		opts = append(opts, redsync.WithRetryDelay(o.RetryDelay))
+	}
+	return opts
+}
+
+// DistributedLock hands out named locks shared by every process using the same Redis.
+type DistributedLock struct {
+	Redsync *redsync.Redsync
+	// Metrics receives the wait time of every acquisition and the failed ones, it is optional.
+	Metrics MetricsSink
+}
+
+// New returns a DistributedLock keeping its locks in rdb, a single server or a cluster
+// client. Use NewFromRedsync to lock across several independent Redis servers.
+func New(rdb redis.UniversalClient) *DistributedLock {
+	return NewFromRedsync(redsync.New(goredis.NewPool(rdb)))
+}
+
+// NewFromRedsync returns a DistributedLock using rs, e.g. one created with a pool per
+// Redis server so locks follow the Redlock quorum.
+func NewFromRedsync(rs *redsync.Redsync) *DistributedLock {
+	return &DistributedLock{
+		Redsync: rs,
+	}
+}
+
+// Acquire locks key and returns the function releasing it. Keys of related locks should
+// share a hash tag, e.g. add-account:{id}, so they map to the same Redis Cluster slot.
+func (l *DistributedLock) Acquire(ctx context.Context, key string, opts Options) (release func() error, err error) {
+	mutex := l.Redsync.NewMutex(key, opts.redsyncOptions()...)
+
+	start := time.Now()
+	err = mutex.LockContext(ctx)
+	l.observeAcquire(key, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+
+	release = releaseFunc(mutex, key)
+	if opts.ExtendInterval > 0 {
+		stop := StartWatchdog(mutex, opts.ExtendInterval)
+		unlock := release
+		release = func() error {
+			stop()
+			return unlock()
+		}
+	}
+	return release, nil
+}
+
+// StartWatchdog extends mutex every interval until the returned stop function is called
+// or an extension fails, in which case the lock is lost and unlocking it fails.
+func StartWatchdog(mutex *redsync.Mutex, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if ok, err := mutex.ExtendContext(context.Background()); !ok || err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		// the mutex is not safe for concurrent use, wait for the watchdog before unlocking
+		<-stopped
+	}
+}
+
+// TryAcquire attempts to lock key exactly once. It returns ErrLockHeld right away
+// if the lock is taken, for latency sensitive paths that should not wait.
+func (l *DistributedLock) TryAcquire(ctx context.Context, key string) (release func() error, err error) {
+	mutex := l.Redsync.NewMutex(key)
+
+	start := time.Now()
+	err = mutex.TryLockContext(ctx)
+	l.observeAcquire(key, start, err)
+	if err != nil {
+		var taken *redsync.ErrTaken
+		if errors.As(err, &taken) || errors.Is(err, redsync.ErrFailed) {
+			return nil, fmt.Errorf("failed to acquire lock %s: %w", key, ErrLockHeld)
+		}
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	return releaseFunc(mutex, key), nil
+}
+
+func releaseFunc(mutex *redsync.Mutex, key string) func() error {
+	return func() error {
+		// the caller's context may be done by now, the lock must still be released
+		ok, err := mutex.UnlockContext(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to release lock %s: %w", key, err)
+		}
+		if !ok {
+			return fmt.Errorf("failed to release lock %s: %w", key, ErrLockLost)
+		}
+		return nil
+	}
+}
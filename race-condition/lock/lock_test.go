@@ -0,0 +1,171 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/azka-zaydan/article-materials/keys"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLock(t *testing.T) (*miniredis.Miniredis, *DistributedLock) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, New(rdb)
+}
+
+func TestDistributedLock_AcquireRelease(t *testing.T) {
+	mr, l := newTestLock(t)
+	key := keys.LockKey("acc-1")
+
+	release, err := l.Acquire(context.Background(), key, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mr.Exists("add-account:{acc-1}") {
+		t.Fatal("expected the hash tagged lock key to exist while held")
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("unexpected release error: %v", err)
+	}
+	if mr.Exists(key) {
+		t.Fatal("expected the lock key to be removed after release")
+	}
+}
+
+func TestDistributedLock_ContentionFailFast(t *testing.T) {
+	_, l := newTestLock(t)
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "contended", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	_, err = l.Acquire(ctx, "contended", Options{FailFast: true})
+	var taken *redsync.ErrTaken
+	if !errors.As(err, &taken) {
+		t.Fatalf("expected the second acquire to fail, got %v", err)
+	}
+}
+
+func TestDistributedLock_ContentionBlocks(t *testing.T) {
+	_, l := newTestLock(t)
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "contended", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const holdFor = 100 * time.Millisecond
+	go func() {
+		time.Sleep(holdFor)
+		release()
+	}()
+
+	start := time.Now()
+	secondRelease, err := l.Acquire(ctx, "contended", Options{Tries: 50, RetryDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("expected the second acquire to wait for the lock, got %v", err)
+	}
+	defer secondRelease()
+
+	if waited := time.Since(start); waited < holdFor/2 {
+		t.Fatalf("expected the second acquire to block, it returned after %v", waited)
+	}
+}
+
+func TestDistributedLock_ReleaseErrorPropagates(t *testing.T) {
+	mr, l := newTestLock(t)
+
+	release, err := l.Acquire(context.Background(), "short-lived", Options{Expiry: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the critical section outlives the lock
+	mr.FastForward(2 * time.Second)
+
+	if err := release(); err == nil {
+		t.Fatal("expected release to report the lost lock")
+	}
+}
+
+func TestDistributedLock_TryAcquireFailsFast(t *testing.T) {
+	_, l := newTestLock(t)
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "contended", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	start := time.Now()
+	_, err = l.TryAcquire(ctx, "contended")
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("expected ErrLockHeld, got %v", err)
+	}
+	// redsync waits at least 50ms between attempts by default, a single attempt never does
+	if elapsed >= 50*time.Millisecond {
+		t.Fatalf("expected TryAcquire to fail without retrying, took %v", elapsed)
+	}
+}
+
+func TestDistributedLock_TryAcquireFree(t *testing.T) {
+	_, l := newTestLock(t)
+
+	release, err := l.TryAcquire(context.Background(), "free")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := release(); err != nil {
+		t.Fatalf("unexpected release error: %v", err)
+	}
+}
+
+func TestDistributedLock_WatchdogExtendsLock(t *testing.T) {
+	mr, l := newTestLock(t)
+	const expiry = time.Second
+
+	release, err := l.Acquire(context.Background(), "long-running", Options{
+		Expiry:         expiry,
+		ExtendInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// miniredis only expires keys when time is fast forwarded, so advance it in steps
+	// shorter than the expiry while giving the watchdog real time to extend in between.
+	// Without extensions the key would be gone after the second step.
+	for i := 0; i < 3; i++ {
+		mr.FastForward(expiry * 6 / 10)
+		time.Sleep(100 * time.Millisecond)
+
+		if !mr.Exists("long-running") {
+			t.Fatalf("lock lost after %v of simulated time", expiry*6/10*time.Duration(i+1))
+		}
+		if ttl := mr.TTL("long-running"); ttl <= expiry*4/10 {
+			t.Fatalf("expected the watchdog to reset the ttl, got %v", ttl)
+		}
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("unexpected release error: %v", err)
+	}
+	if mr.Exists("long-running") {
+		t.Fatal("expected the lock to be released")
+	}
+}
@@ -0,0 +1,32 @@
+package lock
+
+import "time"
+
+// Metric names recorded by DistributedLock.
+const (
+	// MetricAcquireWait is how long an acquisition waited, labelled with the key and
+	// with result "acquired" or "failed".
+	MetricAcquireWait = "lock_acquire_wait"
+	// MetricAcquireFailures counts the acquisitions that gave up, labelled with the key.
+	MetricAcquireFailures = "lock_acquire_failures"
+)
+
+// MetricsSink receives lock measurements. A nil sink disables them.
+type MetricsSink interface {
+	Observe(metric string, value time.Duration, labels map[string]string)
+	Inc(metric string, labels map[string]string)
+}
+
+// observeAcquire records the wait of an acquisition of key that started at start.
+func (l *DistributedLock) observeAcquire(key string, start time.Time, err error) {
+	if l.Metrics == nil {
+		return
+	}
+
+	result := "acquired"
+	if err != nil {
+		result = "failed"
+		l.Metrics.Inc(MetricAcquireFailures, map[string]string{"key": key})
+	}
+	l.Metrics.Observe(MetricAcquireWait, time.Since(start), map[string]string{"key": key, "result": result})
+}
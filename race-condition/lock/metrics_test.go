@@ -0,0 +1,96 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu           sync.Mutex
+	observations map[string][]time.Duration
+	counters     map[string]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		observations: make(map[string][]time.Duration),
+		counters:     make(map[string]int),
+	}
+}
+
+func (m *recordingMetrics) Observe(metric string, value time.Duration, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metric + "," + labels["result"]
+	m.observations[key] = append(m.observations[key], value)
+}
+
+func (m *recordingMetrics) Inc(metric string, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[metric]++
+}
+
+func TestDistributedLock_MetricsRecordWait(t *testing.T) {
+	_, l := newTestLock(t)
+	metrics := newRecordingMetrics()
+	l.Metrics = metrics
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "contended", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const holdFor = 100 * time.Millisecond
+	go func() {
+		time.Sleep(holdFor)
+		release()
+	}()
+
+	secondRelease, err := l.Acquire(ctx, "contended", Options{Tries: 50, RetryDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondRelease()
+
+	waits := metrics.observations[MetricAcquireWait+",acquired"]
+	if len(waits) != 2 {
+		t.Fatalf("expected 2 recorded waits, got %v", waits)
+	}
+	if waits[1] < holdFor {
+		t.Fatalf("expected the contended acquire to record at least %v, got %v", holdFor, waits[1])
+	}
+	if got := metrics.counters[MetricAcquireFailures]; got != 0 {
+		t.Fatalf("expected no failures, got %d", got)
+	}
+}
+
+func TestDistributedLock_MetricsCountFailures(t *testing.T) {
+	_, l := newTestLock(t)
+	metrics := newRecordingMetrics()
+	l.Metrics = metrics
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "contended", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if _, err := l.Acquire(ctx, "contended", Options{Tries: 3, RetryDelay: 10 * time.Millisecond}); err == nil {
+		t.Fatal("expected the acquire to give up")
+	}
+	if _, err := l.TryAcquire(ctx, "contended"); err == nil {
+		t.Fatal("expected the try acquire to fail")
+	}
+
+	if got := metrics.counters[MetricAcquireFailures]; got != 2 {
+		t.Fatalf("expected 2 failed acquisitions, got %d", got)
+	}
+	if got := len(metrics.observations[MetricAcquireWait+",failed"]); got != 2 {
+		t.Fatalf("expected the failed waits to be recorded, got %d", got)
+	}
+}
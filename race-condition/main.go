@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
 	"time"
 
+	"github.com/azka-zaydan/article-materials/keys"
+	"github.com/azka-zaydan/article-materials/race-condition/lock"
 	"github.com/go-redsync/redsync/v4"
 	"github.com/go-redsync/redsync/v4/redis/goredis/v9"
 	"github.com/redis/go-redis/v9"
@@ -20,60 +25,175 @@ func main() {
 	pool := goredis.NewPool(rdb)
 
 	rs := redsync.New(pool)
-	err := AddToBankAccountWithMutex("", 100, rs)
+	balance, err := AddToBankAccountWithMutex("", 100, rs, rdb)
 	if err != nil {
 		return
 	}
+	fmt.Println("New balance:", balance)
 }
 
-func AddToBankAccountWithMutex(accountId string, amount int, redSync *redsync.Redsync) (err error) {
-	// create the mutex with account id
-	mutex := redSync.NewMutex(fmt.Sprintf("add-account:{%s}", accountId))
+// ErrLockContended is returned when the mutex is held by someone else, and stayed held for
+// all the tries. Retrying later may succeed, unlike on a Redis connection error.
+var ErrLockContended = errors.New("lock is held by someone else")
 
+// lockError wraps the redsync errors meaning the lock is held into ErrLockContended and
+// returns the others, such as connection errors, as is.
+func lockError(err error) error {
+	var redisErr *redsync.RedisError
+	if errors.As(err, &redisErr) {
+		return err
+	}
+
+	var taken *redsync.ErrTaken
+	var nodeTaken *redsync.ErrNodeTaken
+	if errors.Is(err, redsync.ErrFailed) || errors.As(err, &taken) || errors.As(err, &nodeTaken) {
+		return fmt.Errorf("%w: %w", ErrLockContended, err)
+	}
+	return err
+}
+
+// NewBankMutex returns the mutex guarding accountId. opts override the redsync defaults,
+// e.g. redsync.WithExpiry for critical sections that may run longer than the default 8s
+// expiry, redsync.WithTries and redsync.WithRetryDelay to tune how long Lock waits.
+func NewBankMutex(rs *redsync.Redsync, accountId string, opts ...redsync.Option) *redsync.Mutex {
+	return rs.NewMutex(keys.LockKey(accountId), opts...)
+}
+
+// WithLock runs fn while holding the mutex named key, opts configure the mutex. The mutex
+// is unlocked on every path, including a panic in fn, which is re-raised once it is
+// unlocked. It returns ErrLockContended if the mutex is held by someone else.
+//
+// A failed unlock means the mutex expired while fn was running, so someone else may have
+// entered the critical section concurrently: it is returned unless fn already failed, in
+// which case fn's error is returned and the unlock failure is logged.
+func WithLock(rs *redsync.Redsync, key string, fn func() error, opts ...redsync.Option) error {
+	return withMutex(rs.NewMutex(key, opts...), fn, 0)
+}
+
+// withMutex is WithLock for an existing mutex, extending it every extendInterval while fn
+// runs when it is not 0.
+func withMutex(mutex *redsync.Mutex, fn func() error, extendInterval time.Duration) (err error) {
 	// lock the mutex, it will fail if the mutex with the same name already exists
 	if err = mutex.Lock(); err != nil {
-		return
+		return lockError(err)
 	}
 
-	// we unlock after the function has done running or if an error occurs
+	// we unlock after the function has done running, if an error occurs or if it panics
 	defer func() {
-		if ok, err := mutex.Unlock(); !ok || err != nil {
-			return
+		p := recover()
+
+		ok, unlockErr := mutex.Unlock()
+		if unlockErr == nil && !ok {
+			unlockErr = lock.ErrLockLost
+		}
+		if unlockErr != nil {
+			unlockErr = fmt.Errorf("failed to release lock %s: %w", mutex.Name(), unlockErr)
+			if err != nil || p != nil {
+				log.Println(unlockErr)
+			} else {
+				err = unlockErr
+			}
+		}
+
+		if p != nil {
+			panic(p)
 		}
 	}()
 
-	// put logic here
+	if extendInterval > 0 {
+		// deferred after the unlock, so the extensions stop before the mutex is unlocked
+		stop := lock.StartWatchdog(mutex, extendInterval)
+		defer stop()
+	}
+
+	return fn()
+}
+
+// AddToBankAccountWithMutex adds amount to the account balance and returns the new balance.
+// The balance is read, updated and written back while holding the account mutex, so
+// concurrent updates of the same account cannot overwrite each other. opts configure the
+// mutex, see NewBankMutex.
+func AddToBankAccountWithMutex(accountId string, amount int, redSync *redsync.Redsync, rdb redis.UniversalClient, opts ...redsync.Option) (balance int, err error) {
+	err = WithLock(redSync, keys.LockKey(accountId), func() (err error) {
+		balance, err = addToBalance(rdb, accountId, amount)
+		return err
+	}, opts...)
+	return balance, err
+}
 
-	return
+// AddToBankAccountWithMutexAutoExtend is AddToBankAccountWithMutex for critical sections that
+// may outlive the mutex expiry: the mutex expires after expiry and is extended every expiry/2
+// until the operation completes, so no other worker can enter while it is still running.
+func AddToBankAccountWithMutexAutoExtend(accountId string, amount int, redSync *redsync.Redsync, rdb redis.UniversalClient, expiry time.Duration, opts ...redsync.Option) (balance int, err error) {
+	mutex := NewBankMutex(redSync, accountId, append(slices.Clip(opts), redsync.WithExpiry(expiry))...)
+	err = withMutex(mutex, func() (err error) {
+		balance, err = addToBalance(rdb, accountId, amount)
+		return err
+	}, expiry/2)
+	return balance, err
 }
 
-func AddToBankAccount(accountId string, amount int, rdb *redis.Client) (err error) {
-	// we first check if the key already exist, if not then continue\
-	exist := true
-	err = rdb.Get(context.Background(), fmt.Sprintf("add-account:{%s}", accountId)).
-		Err()
+// addToBalance adds amount to the stored balance of accountId, the caller holds its mutex.
+func addToBalance(rdb redis.UniversalClient, accountId string, amount int) (balance int, err error) {
+	ctx := context.Background()
+	balance, err = rdb.Get(ctx, keys.BalanceKey(accountId)).Int()
 	if err != nil {
-		// if the error is anything other than redis nil, than we return the error
+		// an account without a stored balance starts at 0
 		if err != redis.Nil {
-			return
+			return 0, fmt.Errorf("failed to get balance: %w", err)
 		}
-		exist = false
+		err = nil
 	}
 
-	if exist {
-		return
+	balance += amount
+	if err = rdb.Set(ctx, keys.BalanceKey(accountId), balance, 0).Err(); err != nil {
+		return 0, fmt.Errorf("failed to set balance: %w", err)
+	}
+	return balance, nil
+}
+
+// DefaultLockTTL is the lock TTL AddToBankAccount uses, it should cover the longest
+// expected run of the operation.
+const DefaultLockTTL = 10 * time.Minute
+
+// applyAmount is the operation guarded by AddToBankAccount's lock.
+var applyAmount = func(accountId string, amount int) error {
+	// put logic here
+	return nil
+}
+
+func AddToBankAccount(accountId string, amount int, rdb redis.UniversalClient) (err error) {
+	return AddToBankAccountWithTTL(accountId, amount, rdb, DefaultLockTTL)
+}
+
+// ErrAlreadyProcessing is returned by AddToBankAccount when the account is already being
+// processed, or a previous attempt failed less than its lock TTL ago.
+var ErrAlreadyProcessing = errors.New("account is already being processed")
+
+// AddToBankAccountWithTTL is AddToBankAccount with the lock expiring after ttl, the
+// expected max duration of the operation. The lock is only deleted once the operation
+// completes cleanly, if it fails or the process crashes the lock stays until ttl passes,
+// so the account is blocked for at most ttl.
+func AddToBankAccountWithTTL(accountId string, amount int, rdb redis.UniversalClient, ttl time.Duration) (err error) {
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
 	}
-	// set the key
-	err = rdb.Set(context.Background(), fmt.Sprintf("add-account:{%s}", accountId), accountId, time.Minute*10).Err()
+
+	// set the key only if it does not exist yet, checking and setting in a single command
+	// so two callers can never both see the key missing and both proceed
+	acquired, err := rdb.SetNX(context.Background(), keys.LockKey(accountId), accountId, ttl).Result()
 	if err != nil {
-		return
+		return fmt.Errorf("failed to set lock: %w", err)
+	}
+	if !acquired {
+		return ErrAlreadyProcessing
 	}
-	// delete the key after the function is done
-	defer func() {
-		rdb.Del(context.Background(), fmt.Sprintf("add-account:{%s}", accountId))
-	}()
 
-	// put logic here
+	err = applyAmount(accountId, amount)
+	if err != nil {
+		return
+	}
 
-	return
+	// delete the key now that the operation is done
+	return rdb.Del(context.Background(), keys.LockKey(accountId)).Err()
 }
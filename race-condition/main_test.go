@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/azka-zaydan/article-materials/keys"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/go-redsync/redsync/v4/redis/goredis/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, rdb
+}
+
+func stubApplyAmount(t *testing.T, fn func(accountId string, amount int) error) {
+	t.Helper()
+	orig := applyAmount
+	applyAmount = fn
+	t.Cleanup(func() { applyAmount = orig })
+}
+
+func TestAddToBankAccountWithTTL_DeletesLockOnCompletion(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+
+	if err := AddToBankAccountWithTTL("acc-1", 100, rdb, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mr.Exists(keys.LockKey("acc-1")) {
+		t.Fatal("expected the lock to be deleted after a clean completion")
+	}
+}
+
+func TestAddToBankAccountWithTTL_LockExpiresAfterCrash(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	const ttl = 30 * time.Second
+
+	stubApplyAmount(t, func(accountId string, amount int) error {
+		panic("crashed mid operation")
+	})
+	func() {
+		defer func() { recover() }()
+		AddToBankAccountWithTTL("acc-1", 100, rdb, ttl)
+	}()
+
+	key := keys.LockKey("acc-1")
+	if !mr.Exists(key) {
+		t.Fatal("expected the lock to outlive the crash")
+	}
+	if got := mr.TTL(key); got != ttl {
+		t.Fatalf("expected the lock ttl to be %v, got %v", ttl, got)
+	}
+
+	mr.FastForward(ttl)
+	if mr.Exists(key) {
+		t.Fatal("expected the lock to expire after the configured ttl")
+	}
+
+	// the account can be retried once the lock expired
+	var applied bool
+	stubApplyAmount(t, func(accountId string, amount int) error {
+		applied = true
+		return nil
+	})
+	if err := AddToBankAccountWithTTL("acc-1", 100, rdb, ttl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !applied {
+		t.Fatal("expected the retry to apply the amount")
+	}
+}
+
+func TestAddToBankAccountWithTTL_KeepsLockOnFailure(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	failure := errors.New("insufficient funds")
+
+	stubApplyAmount(t, func(accountId string, amount int) error {
+		return failure
+	})
+	err := AddToBankAccountWithTTL("acc-1", 100, rdb, time.Minute)
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the operation error, got %v", err)
+	}
+	if !mr.Exists(keys.LockKey("acc-1")) {
+		t.Fatal("expected the lock to be kept until its ttl after a failure")
+	}
+}
+
+func TestAddToBankAccountWithMutex_NoLostUpdates(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	rs := redsync.New(goredis.NewPool(rdb))
+
+	const goroutines = 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := AddToBankAccountWithMutex("acc-1", 1, rs, rdb); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	balance, err := rdb.Get(context.Background(), keys.BalanceKey("acc-1")).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != goroutines {
+		t.Fatalf("expected a balance of %d, got %d", goroutines, balance)
+	}
+}
+
+func TestAddToBankAccountWithMutex_ReturnsNewBalance(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	rs := redsync.New(goredis.NewPool(rdb))
+	mr.Set(keys.BalanceKey("acc-1"), "40")
+
+	balance, err := AddToBankAccountWithMutex("acc-1", 2, rs, rdb)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if balance != 42 {
+		t.Fatalf("expected a balance of 42, got %d", balance)
+	}
+	if mr.Exists(keys.LockKey("acc-1")) {
+		t.Fatal("expected the mutex to be released")
+	}
+}
+
+func TestNewBankMutex_Options(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	rs := redsync.New(goredis.NewPool(rdb))
+	const expiry = 30 * time.Second
+
+	mutex := NewBankMutex(rs, "acc-1", redsync.WithExpiry(expiry), redsync.WithTries(1))
+	if err := mutex.Lock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer mutex.Unlock()
+
+	if got := mr.TTL(keys.LockKey("acc-1")); got != expiry {
+		t.Fatalf("expected the lock to expire after %v, got %v", expiry, got)
+	}
+
+	// a single try gives up right away while the lock is held
+	other := NewBankMutex(rs, "acc-1", redsync.WithTries(1))
+	if err := other.Lock(); err == nil {
+		t.Fatal("expected the second lock to fail while the first one is held")
+	}
+}
+
+func TestAddToBankAccountWithMutex_LockContended(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	rs := redsync.New(goredis.NewPool(rdb))
+
+	holder := NewBankMutex(rs, "acc-1")
+	if err := holder.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Unlock()
+
+	_, err := AddToBankAccountWithMutex("acc-1", 1, rs, rdb, redsync.WithTries(2), redsync.WithRetryDelay(time.Millisecond))
+	if !errors.Is(err, ErrLockContended) {
+		t.Fatalf("expected ErrLockContended, got %v", err)
+	}
+}
+
+func TestAddToBankAccountWithMutex_ConnectionError(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	rs := redsync.New(goredis.NewPool(rdb))
+	mr.Close()
+
+	_, err := AddToBankAccountWithMutex("acc-1", 1, rs, rdb, redsync.WithTries(1))
+	if err == nil {
+		t.Fatal("expected an error with Redis down")
+	}
+	if errors.Is(err, ErrLockContended) {
+		t.Fatalf("expected a connection error to be passed through, got %v", err)
+	}
+	var redisErr *redsync.RedisError
+	if !errors.As(err, &redisErr) {
+		t.Fatalf("expected a redsync.RedisError, got %v", err)
+	}
+}
+
+// expireLockOn deletes the account lock when cmd runs on the balance key, as if the lock
+// expired in the middle of the operation.
+type expireLockOn struct {
+	mr  *miniredis.Miniredis
+	cmd string
+}
+
+func (h expireLockOn) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h expireLockOn) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (h expireLockOn) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if args := cmd.Args(); cmd.Name() == h.cmd && len(args) > 1 && args[1] == keys.BalanceKey("acc-1") {
+			h.mr.Del(keys.LockKey("acc-1"))
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func TestAddToBankAccountWithMutex_LockExpiredMidOperation(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	rs := redsync.New(goredis.NewPool(rdb))
+	rdb.AddHook(expireLockOn{mr: mr, cmd: "set"})
+
+	balance, err := AddToBankAccountWithMutex("acc-1", 5, rs, rdb)
+	if !errors.Is(err, redsync.ErrLockAlreadyExpired) {
+		t.Fatalf("expected the unlock failure to be returned, got %v", err)
+	}
+	// the balance was written, the caller learns it may have raced with another update
+	if balance != 5 {
+		t.Fatalf("expected a balance of 5, got %d", balance)
+	}
+}
+
+func TestAddToBankAccountWithMutex_UnlockFailureLoggedAfterError(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	rs := redsync.New(goredis.NewPool(rdb))
+	mr.Set(keys.BalanceKey("acc-1"), "not-a-number")
+	rdb.AddHook(expireLockOn{mr: mr, cmd: "get"})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	_, err := AddToBankAccountWithMutex("acc-1", 5, rs, rdb)
+	if err == nil || errors.Is(err, redsync.ErrLockAlreadyExpired) {
+		t.Fatalf("expected the balance error to be kept, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "failed to release lock "+keys.LockKey("acc-1")) {
+		t.Fatalf("expected the unlock failure to be logged, got %q", logs.String())
+	}
+}
+
+// slowBalanceGet delays reading the balance, making the critical section outlive the mutex expiry.
+type slowBalanceGet struct {
+	delay time.Duration
+}
+
+func (h slowBalanceGet) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h slowBalanceGet) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (h slowBalanceGet) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if args := cmd.Args(); cmd.Name() == "get" && len(args) > 1 && args[1] == keys.BalanceKey("acc-1") {
+			time.Sleep(h.delay)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+// advanceClock moves the miniredis clock along with the wall clock, so keys expire in real time.
+func advanceClock(t *testing.T, mr *miniredis.Miniredis) {
+	t.Helper()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				mr.FastForward(5 * time.Millisecond)
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+// secondWorkerEntered reports whether another worker acquired the account mutex while run
+// was running.
+func secondWorkerEntered(rs *redsync.Redsync, run func()) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run()
+	}()
+
+	// let the first worker take the lock
+	time.Sleep(20 * time.Millisecond)
+	for {
+		select {
+		case <-done:
+			return false
+		case <-time.After(10 * time.Millisecond):
+			other := NewBankMutex(rs, "acc-1", redsync.WithTries(1))
+			if other.Lock() == nil {
+				other.Unlock()
+				<-done
+				return true
+			}
+		}
+	}
+}
+
+func TestAddToBankAccountWithMutexAutoExtend(t *testing.T) {
+	const expiry = 100 * time.Millisecond
+
+	t.Run("extended past the expiry", func(t *testing.T) {
+		mr, rdb := newTestRedis(t)
+		rs := redsync.New(goredis.NewPool(rdb))
+		rdb.AddHook(slowBalanceGet{delay: 4 * expiry})
+		advanceClock(t, mr)
+
+		var err error
+		entered := secondWorkerEntered(rs, func() {
+			_, err = AddToBankAccountWithMutexAutoExtend("acc-1", 1, rs, rdb, expiry)
+		})
+		if entered {
+			t.Fatal("a second worker entered while the lock was extended")
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("without extension the lock expires", func(t *testing.T) {
+		mr, rdb := newTestRedis(t)
+		rs := redsync.New(goredis.NewPool(rdb))
+		rdb.AddHook(slowBalanceGet{delay: 4 * expiry})
+		advanceClock(t, mr)
+
+		var err error
+		entered := secondWorkerEntered(rs, func() {
+			_, err = AddToBankAccountWithMutex("acc-1", 1, rs, rdb, redsync.WithExpiry(expiry))
+		})
+		if !entered {
+			t.Fatal("expected a second worker to enter once the lock expired")
+		}
+		if err == nil {
+			t.Fatal("expected the expired lock to fail the unlock")
+		}
+	})
+}
+
+func TestWithLock(t *testing.T) {
+	const key = "report:{daily}"
+
+	t.Run("holds the lock while fn runs", func(t *testing.T) {
+		mr, rdb := newTestRedis(t)
+		rs := redsync.New(goredis.NewPool(rdb))
+
+		err := WithLock(rs, key, func() error {
+			if !mr.Exists(key) {
+				t.Error("expected the lock to be held inside fn")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mr.Exists(key) {
+			t.Fatal("expected the lock to be released")
+		}
+	})
+
+	t.Run("returns the error of fn", func(t *testing.T) {
+		mr, rdb := newTestRedis(t)
+		rs := redsync.New(goredis.NewPool(rdb))
+		errReport := errors.New("report failed")
+
+		err := WithLock(rs, key, func() error { return errReport })
+		if !errors.Is(err, errReport) {
+			t.Fatalf("expected %v, got %v", errReport, err)
+		}
+		if mr.Exists(key) {
+			t.Fatal("expected the lock to be released")
+		}
+	})
+
+	t.Run("unlocks and re-panics", func(t *testing.T) {
+		mr, rdb := newTestRedis(t)
+		rs := redsync.New(goredis.NewPool(rdb))
+
+		var recovered any
+		func() {
+			defer func() { recovered = recover() }()
+			WithLock(rs, key, func() error { panic("boom") })
+		}()
+		if recovered != "boom" {
+			t.Fatalf("expected the panic to propagate, got %v", recovered)
+		}
+		if mr.Exists(key) {
+			t.Fatal("expected the lock to be released after the panic")
+		}
+	})
+
+	t.Run("does not run fn when the lock is held", func(t *testing.T) {
+		_, rdb := newTestRedis(t)
+		rs := redsync.New(goredis.NewPool(rdb))
+		holder := rs.NewMutex(key)
+		if err := holder.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		defer holder.Unlock()
+
+		ran := false
+		err := WithLock(rs, key, func() error {
+			ran = true
+			return nil
+		}, redsync.WithTries(1))
+		if !errors.Is(err, ErrLockContended) {
+			t.Fatalf("expected ErrLockContended, got %v", err)
+		}
+		if ran {
+			t.Fatal("expected fn not to run")
+		}
+	})
+}
+
+func TestAddToBankAccountWithTTL_AlreadyProcessing(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	mr.Set(keys.LockKey("acc-1"), "acc-1")
+
+	var applied bool
+	stubApplyAmount(t, func(accountId string, amount int) error {
+		applied = true
+		return nil
+	})
+	err := AddToBankAccountWithTTL("acc-1", 100, rdb, time.Minute)
+	if !errors.Is(err, ErrAlreadyProcessing) {
+		t.Fatalf("expected ErrAlreadyProcessing, got %v", err)
+	}
+	if applied {
+		t.Fatal("expected the amount not to be applied twice")
+	}
+}
+
+func TestAddToBankAccountWithTTL_ConcurrentCallersApplyOnce(t *testing.T) {
+	_, rdb := newTestRedis(t)
+
+	release := make(chan struct{})
+	var applied atomic.Int32
+	stubApplyAmount(t, func(accountId string, amount int) error {
+		applied.Add(1)
+		<-release
+		return nil
+	})
+
+	const callers = 20
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func() { errs <- AddToBankAccountWithTTL("acc-1", 100, rdb, time.Minute) }()
+	}
+
+	// every caller but the one applying the amount is turned away
+	for i := 0; i < callers-1; i++ {
+		if err := <-errs; !errors.Is(err, ErrAlreadyProcessing) {
+			t.Fatalf("expected ErrAlreadyProcessing, got %v", err)
+		}
+	}
+	close(release)
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := applied.Load(); got != 1 {
+		t.Fatalf("expected the amount to be applied once, got %d", got)
+	}
+}
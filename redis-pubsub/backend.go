@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Backend names accepted in PubSubConfig.Backend.
+const (
+	BackendRedis  = "redis"
+	BackendStream = "stream"
+)
+
+var supportedBackends = []string{BackendRedis, BackendStream}
+
+var ErrUnknownBackend = errors.New("unknown pub/sub backend")
+
+type Config struct {
+	PubSub PubSubConfig
+}
+
+type PubSubConfig struct {
+	// Backend picks the implementation, one of BackendRedis or BackendStream.
+	Backend string
+	// Topic is the channel for BackendRedis and the stream for BackendStream.
+	Topic string
+	// Group and Consumer identify the consumer group member, BackendStream only.
+	Group    string
+	Consumer string
+}
+
+// MessagePublisher is implemented by every backend's publisher.
+type MessagePublisher interface {
+	Publish(ctx context.Context, topic string, message string) error
+}
+
+// MessageSubscriber is implemented by every backend's subscriber.
+type MessageSubscriber interface {
+	Listen(ctx context.Context) error
+}
+
+// NewPublisherFromConfig returns the publisher of the backend named in cfg.PubSub.Backend.
+func NewPublisherFromConfig(cfg Config, rdb redis.UniversalClient) (MessagePublisher, error) {
+	switch cfg.PubSub.Backend {
+	case BackendRedis:
+		return NewPublisher(rdb), nil
+	case BackendStream:
+		return NewStreamPublisher(rdb), nil
+	default:
+		return nil, unknownBackend(cfg.PubSub.Backend)
+	}
+}
+
+// NewSubscriberFromConfig returns the subscriber of the backend named in cfg.PubSub.Backend,
+// passing every ProductMessage received on cfg.PubSub.Topic to handler.
+func NewSubscriberFromConfig(cfg Config, rdb redis.UniversalClient, handler func(ctx context.Context, data ProductMessage) error) (MessageSubscriber, error) {
+	switch cfg.PubSub.Backend {
+	case BackendRedis:
+		sub := NewSubscriber[ProductMessage](rdb, cfg.PubSub.Topic)
+		sub.OnMessage = handler
+		return sub, nil
+	case BackendStream:
+		sub := NewStreamSubscriber(rdb, cfg.PubSub.Topic, cfg.PubSub.Group, cfg.PubSub.Consumer)
+		sub.Handler = handler
+		return sub, nil
+	default:
+		return nil, unknownBackend(cfg.PubSub.Backend)
+	}
+}
+
+func unknownBackend(name string) error {
+	return fmt.Errorf("%w %q, supported backends: %s", ErrUnknownBackend, name, strings.Join(supportedBackends, ", "))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewPublisherFromConfig(t *testing.T) {
+	_, rdb := newTestRedis(t)
+
+	tests := []struct {
+		backend string
+		check   func(MessagePublisher) bool
+	}{
+		{BackendRedis, func(p MessagePublisher) bool { _, ok := p.(*Publisher); return ok }},
+		{BackendStream, func(p MessagePublisher) bool { _, ok := p.(*StreamPublisher); return ok }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			pub, err := NewPublisherFromConfig(Config{PubSub: PubSubConfig{Backend: tt.backend}}, rdb)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.check(pub) {
+				t.Errorf("unexpected publisher type %T", pub)
+			}
+		})
+	}
+}
+
+func TestNewSubscriberFromConfig(t *testing.T) {
+	_, rdb := newTestRedis(t)
+
+	tests := []struct {
+		backend string
+		check   func(MessageSubscriber) bool
+	}{
+		{BackendRedis, func(s MessageSubscriber) bool { _, ok := s.(*Subscriber[ProductMessage]); return ok }},
+		{BackendStream, func(s MessageSubscriber) bool { _, ok := s.(*StreamSubscriber); return ok }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			cfg := Config{PubSub: PubSubConfig{Backend: tt.backend, Topic: "product", Group: "workers", Consumer: "worker-a"}}
+			sub, err := NewSubscriberFromConfig(cfg, rdb, printProductMessage)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.check(sub) {
+				t.Errorf("unexpected subscriber type %T", sub)
+			}
+		})
+	}
+}
+
+func TestFromConfig_UnknownBackend(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	cfg := Config{PubSub: PubSubConfig{Backend: "kafka"}}
+
+	if _, err := NewPublisherFromConfig(cfg, rdb); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("publisher: expected ErrUnknownBackend, got %v", err)
+	}
+
+	_, err := NewSubscriberFromConfig(cfg, rdb, printProductMessage)
+	if !errors.Is(err, ErrUnknownBackend) {
+		t.Fatalf("subscriber: expected ErrUnknownBackend, got %v", err)
+	}
+	if want := `unknown pub/sub backend "kafka", supported backends: redis, stream`; err.Error() != want {
+		t.Errorf("unexpected error message %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type bufferedMessage struct {
+	topic   string
+	message string
+}
+
+// DefaultBufferCapacity is the capacity of a BufferedPublisher given none, so an outage
+// never grows the buffer without bound.
+const DefaultBufferCapacity = 1000
+
+// BufferedPublisher keeps publishing available while Redis is down. Messages published
+// during an outage are held in a bounded in-memory queue and flushed, in order, once
+// Redis is healthy again. When the queue is full the oldest message is dropped.
+type BufferedPublisher struct {
+	Publisher *Publisher
+	// Capacity is the maximum number of buffered messages, DefaultBufferCapacity when it
+	// is not positive.
+	Capacity int
+	// Healthy reports whether Redis is reachable, it defaults to a PING.
+	Healthy func(ctx context.Context) bool
+
+	mu      sync.Mutex
+	buffer  []bufferedMessage
+	dropped int
+}
+
+// NewBufferedPublisher returns a BufferedPublisher holding up to capacity messages, or
+// DefaultBufferCapacity when capacity is not positive.
+func NewBufferedPublisher(publisher *Publisher, capacity int) *BufferedPublisher {
+	if capacity <= 0 {
+		capacity = DefaultBufferCapacity
+	}
+	return &BufferedPublisher{
+		Publisher: publisher,
+		Capacity:  capacity,
+	}
+}
+
+func (b *BufferedPublisher) capacity() int {
+	if b.Capacity > 0 {
+		return b.Capacity
+	}
+	return DefaultBufferCapacity
+}
+
+func (b *BufferedPublisher) healthy(ctx context.Context) bool {
+	if b.Healthy != nil {
+		return b.Healthy(ctx)
+	}
+	return b.Publisher.Redis.Ping(ctx).Err() == nil
+}
+
+// Publish sends the message right away when Redis is healthy, otherwise it is buffered.
+// Messages buffered earlier are flushed first so ordering is preserved.
+func (b *BufferedPublisher) Publish(ctx context.Context, topic string, message string) error {
+	if b.healthy(ctx) {
+		if err := b.Flush(ctx); err == nil {
+			if err := b.Publisher.Publish(ctx, topic, message); err == nil {
+				return nil
+			}
+		}
+	}
+
+	b.enqueue(bufferedMessage{topic: topic, message: message})
+	return nil
+}
+
+func (b *BufferedPublisher) enqueue(msg bufferedMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buffer) >= b.capacity() {
+		fmt.Printf("Warning: publish buffer full, dropping oldest message for topic %s\n", b.buffer[0].topic)
+		b.buffer = b.buffer[1:]
+		b.dropped++
+	}
+	b.buffer = append(b.buffer, msg)
+}
+
+// Flush publishes the buffered messages in order, stopping at the first failure.
+func (b *BufferedPublisher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.buffer) > 0 {
+		msg := b.buffer[0]
+		if err := b.Publisher.Publish(ctx, msg.topic, msg.message); err != nil {
+			return fmt.Errorf("failed to flush buffered messages: %w", err)
+		}
+		b.buffer = b.buffer[1:]
+	}
+	return nil
+}
+
+// Buffered returns the number of messages waiting to be flushed.
+func (b *BufferedPublisher) Buffered() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.buffer)
+}
+
+// Dropped returns the number of messages dropped because the buffer was full.
+func (b *BufferedPublisher) Dropped() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Run checks the health of Redis every interval and flushes the buffer once it recovers.
+// It blocks until ctx is cancelled.
+func (b *BufferedPublisher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if b.Buffered() == 0 || !b.healthy(ctx) {
+				continue
+			}
+			if err := b.Flush(ctx); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
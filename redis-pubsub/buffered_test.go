@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBufferedPublisher_FlushesOnRecovery(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pubSub := rdb.Subscribe(ctx, "product")
+	defer pubSub.Close()
+	if _, err := pubSub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ch := pubSub.Channel()
+
+	publisher := NewBufferedPublisher(NewPublisher(rdb), 2)
+
+	// Redis goes down, every command fails
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+
+	for _, msg := range []string{"first", "second", "third"} {
+		if err := publisher.Publish(ctx, "product", msg); err != nil {
+			t.Fatalf("publish during outage should buffer, got %v", err)
+		}
+	}
+
+	if got := publisher.Buffered(); got != 2 {
+		t.Fatalf("expected 2 buffered messages, got %d", got)
+	}
+	if got := publisher.Dropped(); got != 1 {
+		t.Fatalf("expected the oldest message to be dropped, got %d dropped", got)
+	}
+
+	// Redis recovers
+	mr.SetError("")
+	go publisher.Run(ctx, 10*time.Millisecond)
+
+	for _, want := range []string{"second", "third"} {
+		select {
+		case msg := <-ch:
+			if msg.Payload != want {
+				t.Fatalf("expected %q, got %q", want, msg.Payload)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("buffered message %q was never flushed", want)
+		}
+	}
+
+	if got := publisher.Buffered(); got != 0 {
+		t.Fatalf("expected empty buffer after flush, got %d", got)
+	}
+}
+
+func TestBufferedPublisher_PublishesDirectlyWhenHealthy(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	pubSub := rdb.Subscribe(ctx, "product")
+	defer pubSub.Close()
+	if _, err := pubSub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := NewBufferedPublisher(NewPublisher(rdb), 2)
+	if err := publisher.Publish(ctx, "product", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-pubSub.Channel():
+		if msg.Payload != "hello" {
+			t.Fatalf("unexpected payload %q", msg.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not published")
+	}
+	if got := publisher.Buffered(); got != 0 {
+		t.Fatalf("expected nothing buffered, got %d", got)
+	}
+}
+
+func TestBufferedPublisher_DefaultCapacity(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if got := NewBufferedPublisher(NewPublisher(rdb), 0).Capacity; got != DefaultBufferCapacity {
+		t.Fatalf("expected capacity %d, got %d", DefaultBufferCapacity, got)
+	}
+
+	// a zero value config is bounded too
+	publisher := &BufferedPublisher{
+		Publisher: NewPublisher(rdb),
+		// Redis is down for the whole test
+		Healthy: func(context.Context) bool { return false },
+	}
+	for i := 0; i < DefaultBufferCapacity+1; i++ {
+		if err := publisher.Publish(ctx, "product", "message"); err != nil {
+			t.Fatalf("publish during outage should buffer, got %v", err)
+		}
+	}
+
+	if got := publisher.Buffered(); got != DefaultBufferCapacity {
+		t.Fatalf("expected %d buffered messages, got %d", DefaultBufferCapacity, got)
+	}
+	if got := publisher.Dropped(); got != 1 {
+		t.Fatalf("expected the oldest message to be dropped, got %d dropped", got)
+	}
+}
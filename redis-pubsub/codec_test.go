@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var codecs = map[string]Codec{
+	"encoding/json": StdJSONCodec{},
+	"jsoniter":      JsoniterCodec{},
+	"pooled":        NewPooledJSONCodec(0),
+}
+
+func TestCodecs_Equivalent(t *testing.T) {
+	msg := &ProductMessage{Product: NewProduct(1, "Laptop \"Pro\" <15>"), Action: "create", Sequence: 7}
+
+	want, err := StdJSONCodec{}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range codecs {
+		t.Run(name, func(t *testing.T) {
+			got, err := c.Marshal(msg)
+			if err != nil {
+				t.Fatalf("Marshal returned error: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Marshal = %s, want %s", got, want)
+			}
+
+			var decoded ProductMessage
+			if err := c.Unmarshal(want, &decoded); err != nil {
+				t.Fatalf("Unmarshal returned error: %v", err)
+			}
+			if !reflect.DeepEqual(&decoded, msg) {
+				t.Errorf("Unmarshal = %+v, want %+v", decoded, msg)
+			}
+		})
+	}
+}
+
+func TestPooledJSONCodec_MatchesMarshal(t *testing.T) {
+	c := NewPooledJSONCodec(0)
+	publishedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	values := []any{
+		&ProductMessage{Product: NewProduct(1, "Laptop \"Pro\" <15> & more"), Action: "create", Sequence: 7},
+		&ProductMessage{Action: "delete"},
+		&Envelope{Version: 2, PublishedAt: publishedAt, Payload: json.RawMessage(`{"id": 1,  "name":"Laptop"}`)},
+		map[string]any{"b": []int{1, 2}, "a": "\u2028"},
+		"plain",
+		nil,
+	}
+
+	var previous []byte
+	for _, v := range values {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal returned error: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Marshal(%#v) = %s, want %s", v, got, want)
+		}
+
+		// the result must not share the buffer reused by the next Marshal
+		if previous != nil && bytes.Equal(previous, got) {
+			t.Errorf("result of the previous Marshal was overwritten with %s", got)
+		}
+		previous = got
+	}
+}
+
+func TestPooledJSONCodec_DropsLargeBuffers(t *testing.T) {
+	c := NewPooledJSONCodec(16)
+
+	if _, err := c.Marshal(strings.Repeat("x", 64)); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := c.pool.Get().(*pooledEncoder); ok {
+		t.Fatalf("expected the %d byte buffer to be dropped", e.buf.Cap())
+	}
+}
+
+func TestProductMessage_ToBytesPooled(t *testing.T) {
+	t.Cleanup(func() { SetCodec(nil) })
+	msg := NewProductMessage(NewProduct(1, "Laptop <15>"), "create")
+
+	std, err := msg.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCodec(NewPooledJSONCodec(0))
+	pooled, err := msg.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdEnv, pooledEnv Envelope
+	if err := json.Unmarshal(std, &stdEnv); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(pooled, &pooledEnv); err != nil {
+		t.Fatal(err)
+	}
+	if pooledEnv.Version != stdEnv.Version || !bytes.Equal(pooledEnv.Payload, stdEnv.Payload) {
+		t.Errorf("pooled envelope %+v, want %+v", pooledEnv, stdEnv)
+	}
+}
+
+func TestSetCodec(t *testing.T) {
+	t.Cleanup(func() { SetCodec(nil) })
+
+	SetCodec(JsoniterCodec{})
+	if _, ok := codec.(JsoniterCodec); !ok {
+		t.Fatalf("expected JsoniterCodec, got %T", codec)
+	}
+
+	SetCodec(nil)
+	if _, ok := codec.(StdJSONCodec); !ok {
+		t.Fatalf("expected nil to restore StdJSONCodec, got %T", codec)
+	}
+}
+
+func BenchmarkCodec_Marshal(b *testing.B) {
+	msg := &ProductMessage{Product: NewProduct(1, "Laptop"), Action: "create", Sequence: 7}
+	for name, c := range codecs {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Marshal(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProductMessage_ToBytes(b *testing.B) {
+	b.Cleanup(func() { SetCodec(nil) })
+	msg := NewProductMessage(NewProduct(1, "Laptop"), "create")
+	for name, c := range map[string]Codec{
+		"encoding/json": StdJSONCodec{},
+		"pooled":        NewPooledJSONCodec(0),
+	} {
+		b.Run(name, func(b *testing.B) {
+			SetCodec(c)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := msg.ToBytes(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCodec_Unmarshal(b *testing.B) {
+	payload, err := StdJSONCodec{}.Marshal(NewProductMessage(NewProduct(1, "Laptop"), "create"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for name, c := range codecs {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var msg ProductMessage
+				if err := c.Unmarshal(payload, &msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
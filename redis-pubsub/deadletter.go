@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrDeadLetterNotFound is returned when reprocessing an id that is not in the queue.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a message that failed processing, along with why and where it came from.
+type DeadLetter struct {
+	ID        string    `json:"id"`
+	Topic     string    `json:"topic"`
+	Payload   string    `json:"payload"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DeadLetterQueue stores failed messages in a Redis list, newest first.
+type DeadLetterQueue struct {
+	Redis redis.UniversalClient
+	Key   string
+	// MaxLen is how many entries are retained, older entries are trimmed. 0 keeps everything.
+	MaxLen int64
+}
+
+func NewDeadLetterQueue(rdb redis.UniversalClient, key string, maxLen int64) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		Redis:  rdb,
+		Key:    key,
+		MaxLen: maxLen,
+	}
+}
+
+// Push records a failed message together with the error that caused it.
+func (q *DeadLetterQueue) Push(ctx context.Context, topic string, payload string, cause error) error {
+	seq, err := q.Redis.Incr(ctx, q.Key+":seq").Result()
+	if err != nil {
+		return fmt.Errorf("failed to generate dead letter id: %w", err)
+	}
+
+	entry := DeadLetter{
+		ID:        strconv.FormatInt(seq, 10),
+		Topic:     topic,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	_, err = q.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, q.Key, entryBytes)
+		if q.MaxLen > 0 {
+			pipe.LTrim(ctx, q.Key, 0, q.MaxLen-1)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push dead letter: %w", err)
+	}
+	return nil
+}
+
+// DeadLetters returns up to limit of the most recent dead letters. A non-positive limit returns all of them.
+func (q *DeadLetterQueue) DeadLetters(ctx context.Context, limit int64) ([]DeadLetter, error) {
+	entries, err := q.Redis.LRange(ctx, q.Key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+
+	deadLetters := make([]DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		var dl DeadLetter
+		if err := json.Unmarshal([]byte(entry), &dl); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+		}
+		deadLetters = append(deadLetters, dl)
+	}
+	return deadLetters, nil
+}
+
+// Reprocess republishes a dead letter to its original topic and removes it from the queue.
+func (q *DeadLetterQueue) Reprocess(ctx context.Context, id string) error {
+	entries, err := q.Redis.LRange(ctx, q.Key, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read dead letters: %w", err)
+	}
+
+	for _, entry := range entries {
+		var dl DeadLetter
+		if err := json.Unmarshal([]byte(entry), &dl); err != nil || dl.ID != id {
+			continue
+		}
+
+		if err := q.Redis.Publish(ctx, dl.Topic, dl.Payload).Err(); err != nil {
+			return fmt.Errorf("failed to republish dead letter: %w", err)
+		}
+		if err := q.Redis.LRem(ctx, q.Key, 1, entry).Err(); err != nil {
+			return fmt.Errorf("failed to remove dead letter: %w", err)
+		}
+		return nil
+	}
+	return ErrDeadLetterNotFound
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterQueue_ListAndReprocess(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dlq := NewDeadLetterQueue(rdb, "product:dlq", 10)
+	received := make(chan ProductMessage, 1)
+	attempts := 0
+
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.DeadLetters = dlq
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		attempts++
+		// fail the first delivery so the message is dead-lettered
+		if attempts == 1 {
+			return errors.New("downstream unavailable")
+		}
+		received <- data
+		return nil
+	}
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "product")
+
+	payload, err := NewProductMessage(NewProduct(1, "Laptop"), "create").ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.Publish(ctx, "product", payload).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var deadLetters []DeadLetter
+	deadline := time.Now().Add(2 * time.Second)
+	for len(deadLetters) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if deadLetters, err = dlq.DeadLetters(ctx, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(deadLetters))
+	}
+
+	dl := deadLetters[0]
+	if dl.Topic != "product" || dl.Error != "downstream unavailable" || dl.Payload != string(payload) || dl.Timestamp.IsZero() {
+		t.Fatalf("unexpected dead letter: %+v", dl)
+	}
+
+	if err := dlq.Reprocess(ctx, dl.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-received:
+		if data.Product.ID != 1 || data.Action != "create" {
+			t.Fatalf("unexpected message: %+v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reprocessed message never reached the subscriber")
+	}
+
+	remaining, err := dlq.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Fatalf("expected dead letter to be removed, got %d", len(remaining))
+	}
+
+	if err := dlq.Reprocess(ctx, dl.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("expected ErrDeadLetterNotFound, got %v", err)
+	}
+}
+
+func TestDeadLetterQueue_Retention(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+	dlq := NewDeadLetterQueue(rdb, "product:dlq", 2)
+
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := dlq.Push(ctx, "product", payload, errors.New("bad")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadLetters, err := dlq.DeadLetters(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 2 || deadLetters[0].Payload != "c" || deadLetters[1].Payload != "b" {
+		t.Fatalf("expected the 2 newest dead letters, got %+v", deadLetters)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeLegacyPipe parses the legacy "id|name|action" format.
+func decodeLegacyPipe(payload []byte) (ProductMessage, bool) {
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 3 {
+		return ProductMessage{}, false
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ProductMessage{}, false
+	}
+	return ProductMessage{Product: NewProduct(id, parts[1]), Action: parts[2]}, true
+}
+
+func TestSubscriber_FallbackDecoders(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan ProductMessage, 1)
+	notLegacy := func(payload []byte) (ProductMessage, bool) { return ProductMessage{}, false }
+
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.FallbackDecoders = []FallbackDecoder[ProductMessage]{notLegacy, decodeLegacyPipe}
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		received <- data
+		return nil
+	}
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "product")
+
+	if err := rdb.Publish(ctx, "product", "7|Keyboard|update").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-received:
+		if data.Product.ID != 7 || data.Product.Name != "Keyboard" || data.Action != "update" {
+			t.Fatalf("unexpected message: %+v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("legacy message was dropped")
+	}
+}
+
+func TestSubscriber_DecodeWithoutMatchingFallback(t *testing.T) {
+	sub := &Subscriber[ProductMessage]{FallbackDecoders: []FallbackDecoder[ProductMessage]{decodeLegacyPipe}}
+
+	if _, err := sub.decode([]byte("not json")); err == nil {
+		t.Fatal("expected an error when no decoder recognizes the payload")
+	}
+}
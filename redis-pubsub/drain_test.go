@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscriber_DrainsBufferedMessagesOnCancel(t *testing.T) {
+	const messages = 5
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{}, messages)
+	release := make(chan struct{})
+
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() { done <- sub.Listen(ctx) }()
+
+	waitForSubscriber(t, mr, "product")
+	for i := 1; i <= messages; i++ {
+		payload, err := NewProductMessage(NewProduct(i, "Laptop"), "create").ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rdb.Publish(context.Background(), "product", payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first message blocks the handler, the rest are buffered by the time it is cancelled
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Listen returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return after cancel")
+	}
+
+	if got := sub.LastProcessedID(); got != messages {
+		t.Errorf("expected %d processed messages before shutdown, got %d", messages, got)
+	}
+}
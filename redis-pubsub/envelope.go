@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProductMessageVersion is the schema version of ProductMessage set by NewProductMessage.
+const ProductMessageVersion = 1
+
+// Envelope wraps a published payload with its schema version and publish time, so
+// consumers can tell message generations apart during rolling deployments.
+type Envelope struct {
+	Version     int             `json:"version"`
+	PublishedAt time.Time       `json:"published_at"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// VersionDecoder decodes the payload of an envelope with a given schema version into T,
+// e.g. to upgrade v1 messages for a v2 consumer.
+type VersionDecoder[T any] func(payload json.RawMessage) (T, error)
+
+// NewEnvelope encodes v with the package codec and wraps it as the given version.
+func NewEnvelope(version int, v any) (*Envelope, error) {
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return &Envelope{
+		Version:     version,
+		PublishedAt: time.Now().UTC(),
+		Payload:     payload,
+	}, nil
+}
+
+// marshalEnvelope is codec.Marshal(NewEnvelope(version, v)), except the payload is
+// wrapped straight from its pooled buffer instead of being copied out first.
+func (c *PooledJSONCodec) marshalEnvelope(version int, v any) (out []byte, err error) {
+	var envErr error
+	err = c.Encode(v, func(payload []byte) error {
+		out, envErr = c.Marshal(&Envelope{
+			Version:     version,
+			PublishedAt: time.Now().UTC(),
+			Payload:     payload,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return out, envErr
+}
+
+// openEnvelope returns the envelope data is wrapped in. It reports false for
+// messages published without one, which are decoded as they are.
+func openEnvelope(data []byte) (Envelope, bool) {
+	var env Envelope
+	if err := codec.Unmarshal(data, &env); err != nil || env.Version == 0 || len(env.Payload) == 0 {
+		return Envelope{}, false
+	}
+	return env, true
+}
+
+// unmarshalMessage decodes data into v, unwrapping its envelope if it has one.
+func unmarshalMessage(data []byte, v any) error {
+	if env, ok := openEnvelope(data); ok {
+		data = env.Payload
+	}
+	return codec.Unmarshal(data, v)
+}
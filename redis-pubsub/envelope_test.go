@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// productMessageV2 is how a consumer upgraded to a newer schema sees product messages.
+type productMessageV2 struct {
+	ProductID int    `json:"product_id"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+}
+
+func upgradeProductMessageV1(payload json.RawMessage) (productMessageV2, error) {
+	var v1 ProductMessage
+	if err := json.Unmarshal(payload, &v1); err != nil {
+		return productMessageV2{}, err
+	}
+	return productMessageV2{ProductID: v1.Product.ID, Name: v1.Product.Name, Action: v1.Action}, nil
+}
+
+func TestProductMessage_ToBytesWrapsEnvelope(t *testing.T) {
+	before := time.Now().UTC()
+	payload, err := NewProductMessage(NewProduct(1, "Laptop"), "create").ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		t.Fatalf("payload is not an envelope: %v", err)
+	}
+	if env.Version != ProductMessageVersion {
+		t.Errorf("expected version %d, got %d", ProductMessageVersion, env.Version)
+	}
+	if env.PublishedAt.Before(before) || env.PublishedAt.After(time.Now().UTC()) {
+		t.Errorf("unexpected publish time %v", env.PublishedAt)
+	}
+
+	var msg ProductMessage
+	if err := json.Unmarshal(env.Payload, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Product.ID != 1 || msg.Action != "create" {
+		t.Errorf("unexpected payload: %+v", msg)
+	}
+}
+
+func TestSubscriber_VersionDispatch(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan productMessageV2, 3)
+	sub := NewSubscriber[productMessageV2](rdb, "product")
+	sub.VersionDecoders = map[int]VersionDecoder[productMessageV2]{1: upgradeProductMessageV1}
+	sub.OnMessage = func(ctx context.Context, data productMessageV2) error {
+		received <- data
+		return nil
+	}
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "product")
+
+	publish := func(payload []byte) {
+		t.Helper()
+		if err := rdb.Publish(ctx, "product", payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a producer that was not upgraded yet still sends v1
+	v1, err := NewProductMessage(NewProduct(1, "Laptop"), "create").ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(v1)
+
+	// an upgraded producer sends v2, which has no decoder and is decoded as it is
+	env, err := NewEnvelope(2, productMessageV2{ProductID: 2, Name: "Mouse", Action: "update"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(v2)
+
+	// messages published before envelopes existed are decoded as they are
+	publish([]byte(`{"product_id":3,"name":"Keyboard","action":"delete"}`))
+
+	want := []productMessageV2{
+		{ProductID: 1, Name: "Laptop", Action: "create"},
+		{ProductID: 2, Name: "Mouse", Action: "update"},
+		{ProductID: 3, Name: "Keyboard", Action: "delete"},
+	}
+	for _, w := range want {
+		select {
+		case got := <-received:
+			if got != w {
+				t.Fatalf("expected %+v, got %+v", w, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %+v was not received", w)
+		}
+	}
+}
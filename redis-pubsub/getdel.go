@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GetDel reads the JSON value stored at key and deletes the key in the same GETDEL
+// command, so only one caller ever consumes a value, e.g. a one-time token.
+// A missing key returns false with a nil error.
+func GetDel[T any](ctx context.Context, rdb redis.UniversalClient, key string) (T, bool, error) {
+	var value T
+
+	raw, err := rdb.GetDel(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, fmt.Errorf("failed to get and delete %s: %w", key, err)
+	}
+
+	// the value is stored as is, unlike published messages it is never wrapped in an Envelope
+	if err := codec.Unmarshal(raw, &value); err != nil {
+		return value, false, fmt.Errorf("failed to unmarshal %s: %w", key, err)
+	}
+	return value, true, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetDel(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	payload, err := codec.Marshal(NewProductMessage(NewProduct(1, "Laptop"), "create"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mr.Set("token:1", string(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok, err := GetDel[ProductMessage](ctx, rdb, "token:1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok || msg.Product.ID != 1 || msg.Action != "create" {
+		t.Fatalf("expected product 1, got ok=%v msg=%+v", ok, msg)
+	}
+	if mr.Exists("token:1") {
+		t.Error("expected key to be deleted after GetDel")
+	}
+
+	_, ok, err = GetDel[ProductMessage](ctx, rdb, "token:1")
+	if err != nil {
+		t.Fatalf("unexpected error on miss: %v", err)
+	}
+	if ok {
+		t.Error("expected second GetDel to report a miss")
+	}
+}
+
+func TestGetDel_DoesNotUnwrapEnvelopes(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	// a stored value shaped like an envelope is returned whole, not replaced by its payload
+	payload, err := NewProductMessage(NewProduct(1, "Laptop"), "create").ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mr.Set("envelope:1", string(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	env, ok, err := GetDel[Envelope](ctx, rdb, "envelope:1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok || env.Version != ProductMessageVersion || len(env.Payload) == 0 {
+		t.Fatalf("expected the stored envelope, got ok=%v env=%+v", ok, env)
+	}
+}
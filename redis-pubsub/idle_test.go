@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscriber_IdleTimeout(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	const idle = 200 * time.Millisecond
+
+	received := make(chan ProductMessage, 2)
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.IdleTimeout = idle
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		received <- data
+		return nil
+	}
+
+	done := make(chan error)
+	go func() { done <- sub.Listen(context.Background()) }()
+	<-sub.Ready()
+
+	// each message is published well within the idle timeout of the previous one
+	var lastMessage time.Time
+	for i := 1; i <= 2; i++ {
+		time.Sleep(idle / 2)
+		payload, err := NewProductMessage(NewProduct(i, "Laptop"), "create").ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rdb.Publish(context.Background(), "product", payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+		<-received
+		lastMessage = time.Now()
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not exit after the idle timeout")
+	}
+
+	if elapsed := time.Since(lastMessage); elapsed < idle*9/10 {
+		t.Fatalf("expected the subscriber to wait %v after the last message, exited after %v", idle, elapsed)
+	}
+	if got := sub.LastProcessedID(); got != 2 {
+		t.Fatalf("expected both messages to be processed, got %d", got)
+	}
+}
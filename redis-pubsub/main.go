@@ -2,81 +2,485 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-type Subscriber struct {
-	Redis *redis.Client
+// Subscriber decodes the JSON messages of a topic into T and hands them to OnMessage.
+type Subscriber[T any] struct {
+	Redis redis.UniversalClient
 	Topic string
+	// OnMessage processes each decoded message, it defaults to printing the message.
+	OnMessage func(ctx context.Context, data T) error
+	// OnError receives the errors returned by OnMessage, it defaults to logging them.
+	OnError func(ctx context.Context, err error)
+	// DeadLetters receives messages that could not be decoded or handled, it is optional.
+	DeadLetters *DeadLetterQueue
+	// VersionDecoders decode enveloped payloads by schema version. Versions without a
+	// decoder, and messages without an envelope, are decoded into T directly.
+	VersionDecoders map[int]VersionDecoder[T]
+	// FallbackDecoders are tried in order when a payload is not valid JSON,
+	// e.g. to still accept messages in a known legacy format.
+	FallbackDecoders []FallbackDecoder[T]
+	// Metrics receives the per-message processing and decoding durations, it is optional.
+	Metrics MetricsSink
+	// Redactor masks sensitive fields of payloads that are logged, it is optional.
+	Redactor *Redactor
+	// OnSequenceGap is called when a sequenced message does not directly follow
+	// the previous one on its topic, it defaults to logging the gap.
+	OnSequenceGap func(topic string, expected, got int64)
+	// ReconnectBackoff controls how Listen re-subscribes after the channel closes.
+	ReconnectBackoff Backoff
+	// HandlerTimeout bounds each OnMessage call, a call exceeding it has its context cancelled
+	// and counts as failed, so it is dead-lettered and the next message is processed. The
+	// timed out call may keep running concurrently if it ignores its context. 0 disables it.
+	HandlerTimeout time.Duration
+	// DrainTimeout bounds how long Listen keeps processing the messages already buffered
+	// when ctx is cancelled, 0 drops them.
+	DrainTimeout time.Duration
+	// IdleTimeout makes Listen return once no message has been received for this long,
+	// for one-shot consumers that should exit after draining a topic. 0 disables it.
+	IdleTimeout time.Duration
+
+	middlewares  []Middleware[T]
+	processed    atomic.Int64
+	lastSequence map[string]int64
+	idleTimer    *time.Timer
+	ready        chan struct{}
+	readyInit    sync.Once
+	readyClose   sync.Once
+	// subscribed is called with every new subscription, tests use it to simulate a dropped connection.
+	subscribed func(pubSub *redis.PubSub)
+}
+
+// Backoff is an exponential backoff. Zero fields fall back to the defaults of NewBackoff.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+func NewBackoff() Backoff {
+	return Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        30 * time.Second,
+		Multiplier: 2,
+	}
+}
+
+func (b Backoff) withDefaults() Backoff {
+	defaults := NewBackoff()
+	if b.Initial <= 0 {
+		b.Initial = defaults.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = defaults.Max
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = defaults.Multiplier
+	}
+	return b
+}
+
+// Next returns the delay following delay, capped at Max.
+func (b Backoff) Next(delay time.Duration) time.Duration {
+	next := time.Duration(float64(delay) * b.Multiplier)
+	if next > b.Max {
+		return b.Max
+	}
+	return next
+}
+
+// FallbackDecoder attempts to decode a payload that the codec rejected.
+// It reports false when it does not recognize the payload.
+type FallbackDecoder[T any] func(payload []byte) (T, bool)
+
+// Sequenced is implemented by messages carrying a per-topic sequence number.
+type Sequenced interface {
+	SequenceNumber() int64
 }
 
+// DefaultDrainTimeout is the DrainTimeout set by NewSubscriber.
+const DefaultDrainTimeout = 2 * time.Second
+
+// DefaultPublishTimeout bounds a single publish when Publisher.Timeout is not set.
+const DefaultPublishTimeout = 5 * time.Second
+
 type Publisher struct {
-	Redis *redis.Client
+	Redis redis.UniversalClient
+	// Timeout bounds each publish, defaults to DefaultPublishTimeout.
+	Timeout time.Duration
+	// Redactor masks sensitive fields of payloads that are logged, it is optional.
+	Redactor *Redactor
+	// Metrics receives the duration of every PUBLISH call, it is optional.
+	Metrics MetricsSink
+
+	// now replaces time.Now when timing publishes, for tests.
+	now func() time.Time
 }
 
-func NewSubscriber(rdb *redis.Client, topic string) *Subscriber {
-	return &Subscriber{
-		Redis: rdb,
-		Topic: topic,
+func NewSubscriber[T any](rdb redis.UniversalClient, topic string) *Subscriber[T] {
+	return &Subscriber[T]{
+		Redis:            rdb,
+		Topic:            topic,
+		ReconnectBackoff: NewBackoff(),
+		DrainTimeout:     DefaultDrainTimeout,
 	}
 }
 
-func NewPublisher(rdb *redis.Client) *Publisher {
+func NewPublisher(rdb redis.UniversalClient) *Publisher {
 	return &Publisher{
-		Redis: rdb,
+		Redis:   rdb,
+		Timeout: DefaultPublishTimeout,
 	}
 }
 
-func (s *Subscriber) Listen(ctx context.Context) {
+// Listen processes messages until ctx is cancelled. When the channel closes it
+// re-subscribes with exponential backoff, the backoff resets once a message arrives.
+// It returns nil once ctx is cancelled.
+func (s *Subscriber[T]) Listen(ctx context.Context) error {
 	fmt.Println("Listening for messages...")
+	if s.IdleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		s.idleTimer = time.AfterFunc(s.IdleTimeout, func() {
+			fmt.Printf("No messages for %v, shutting down...\n", s.IdleTimeout)
+			cancel()
+		})
+		defer s.idleTimer.Stop()
+	}
+	backoff := s.ReconnectBackoff.withDefaults()
+	delay := backoff.Initial
+
+	for attempt := 1; ; attempt++ {
+		received := s.listen(ctx)
+		if ctx.Err() != nil {
+			fmt.Println("Subscriber shutting down...")
+			return nil
+		}
+
+		if received {
+			delay = backoff.Initial
+			attempt = 1
+		}
+		fmt.Printf("Channel closed, reconnecting in %v (attempt %d)\n", delay, attempt)
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("Subscriber shutting down...")
+			return nil
+		case <-time.After(delay):
+		}
+		delay = backoff.Next(delay)
+	}
+}
+
+// listen consumes a single subscription until its channel closes or ctx is cancelled,
+// and reports whether any message was received.
+func (s *Subscriber[T]) listen(ctx context.Context) (received bool) {
 	pubSub := s.Redis.Subscribe(ctx, s.Topic)
 	defer pubSub.Close()
 
+	if s.subscribed != nil {
+		s.subscribed(pubSub)
+	}
+	// wait for the subscribe confirmation, messages published before it are not delivered
+	if _, err := pubSub.Receive(ctx); err != nil {
+		if ctx.Err() == nil {
+			fmt.Println("Failed to subscribe:", err)
+		}
+		return false
+	}
+	s.markReady()
 	ch := pubSub.Channel()
 
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Println("Subscriber shutting down...")
+			s.drain(ctx, ch)
+			return received
+		case msg, ok := <-ch:
+			if !ok {
+				return received
+			}
+			received = true
+			s.process(ctx, msg)
+		}
+	}
+}
+
+// drain processes the messages already buffered in ch after ctx is cancelled, until
+// ch is empty or DrainTimeout has passed.
+func (s *Subscriber[T]) drain(ctx context.Context, ch <-chan *redis.Message) {
+	if s.DrainTimeout <= 0 {
+		return
+	}
+	// ctx is already cancelled, handlers get one bounded by DrainTimeout instead
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.DrainTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Drain timed out, dropping buffered messages")
 			return
 		case msg, ok := <-ch:
 			if !ok {
-				fmt.Println("Channel closed")
 				return
 			}
+			s.process(ctx, msg)
+		default:
+			return
+		}
+	}
+}
 
-			if msg.Payload == "" {
-				fmt.Println("Empty message received")
-				continue
-			}
+func (s *Subscriber[T]) process(ctx context.Context, msg *redis.Message) {
+	defer s.processed.Add(1)
+	if s.idleTimer != nil {
+		// a handler running longer than IdleTimeout does not count as idle
+		s.idleTimer.Stop()
+		defer s.idleTimer.Reset(s.IdleTimeout)
+	}
 
-			var data ProductMessage
-			err := json.Unmarshal([]byte(msg.Payload), &data)
-			if err != nil {
-				fmt.Println("Failed to unmarshal message:", err)
-				continue
-			}
+	if msg.Payload == "" {
+		fmt.Println("Empty message received")
+		return
+	}
+	s.handle(ctx, msg)
+}
+
+// Ready returns a channel that is closed once the first subscription is confirmed,
+// so callers can wait on it before publishing.
+func (s *Subscriber[T]) Ready() <-chan struct{} {
+	s.readyInit.Do(func() { s.ready = make(chan struct{}) })
+	return s.ready
+}
 
-			fmt.Printf("Received - Product ID: %d, Name: %s, Action: %s\n",
-				data.Product.ID, data.Product.Name, data.Action)
+func (s *Subscriber[T]) markReady() {
+	s.Ready()
+	s.readyClose.Do(func() { close(s.ready) })
+}
+
+// LastProcessedID returns the running number of the last processed message, which is
+// the number of messages processed so far.
+func (s *Subscriber[T]) LastProcessedID() int64 {
+	return s.processed.Load()
+}
+
+func (s *Subscriber[T]) handle(ctx context.Context, msg *redis.Message) {
+	if s.Metrics != nil {
+		start := time.Now()
+		defer func() {
+			s.Metrics.Observe(MetricProcessingDuration, time.Since(start), map[string]string{"topic": msg.Channel})
+		}()
+	}
+
+	data, err := s.timedDecode(msg)
+	if err != nil {
+		fmt.Println("Failed to unmarshal message:", err, "payload:", s.Redactor.Redact(msg.Payload))
+		s.deadLetter(ctx, msg, err)
+		return
+	}
+
+	if seq, ok := any(data).(Sequenced); ok {
+		s.checkSequence(msg.Channel, seq.SequenceNumber())
+	}
+
+	var onMessage Handler[T] = s.OnMessage
+	if onMessage == nil {
+		onMessage = printMessage[T]
+	}
+	if err := s.callHandler(ctx, s.chain(onMessage), data); err != nil {
+		onError := s.OnError
+		if onError == nil {
+			onError = logError
 		}
+		onError(ctx, err)
+		s.deadLetter(ctx, msg, err)
 	}
 }
 
+// callHandler runs onMessage under HandlerTimeout, returning a context.DeadlineExceeded
+// error once it is exceeded without waiting for onMessage to return.
+func (s *Subscriber[T]) callHandler(ctx context.Context, onMessage Handler[T], data T) error {
+	if s.HandlerTimeout <= 0 {
+		return onMessage(ctx, data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.HandlerTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- onMessage(ctx, data) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("handler timed out after %v: %w", s.HandlerTimeout, ctx.Err())
+	}
+}
+
+// timedDecode decodes the payload of msg, recording the time it took when Metrics is set.
+func (s *Subscriber[T]) timedDecode(msg *redis.Message) (T, error) {
+	if s.Metrics == nil {
+		return s.decode([]byte(msg.Payload))
+	}
+	start := time.Now()
+	defer func() {
+		s.Metrics.Observe(MetricDecodeDuration, time.Since(start), map[string]string{"topic": msg.Channel})
+	}()
+	return s.decode([]byte(msg.Payload))
+}
+
+func (s *Subscriber[T]) decode(payload []byte) (T, error) {
+	body := payload
+	if env, ok := openEnvelope(payload); ok {
+		if decode, found := s.VersionDecoders[env.Version]; found {
+			return decode(env.Payload)
+		}
+		body = env.Payload
+	}
+
+	var data T
+	err := codec.Unmarshal(body, &data)
+	if err == nil {
+		return data, nil
+	}
+
+	for _, decoder := range s.FallbackDecoders {
+		if data, ok := decoder(payload); ok {
+			return data, nil
+		}
+	}
+	return *new(T), err
+}
+
+// checkSequence flags messages that are missing or out of order. The first
+// sequenced message seen on a topic sets the baseline.
+func (s *Subscriber[T]) checkSequence(topic string, seq int64) {
+	if seq == 0 {
+		return
+	}
+	if s.lastSequence == nil {
+		s.lastSequence = make(map[string]int64)
+	}
+
+	last, seen := s.lastSequence[topic]
+	if seen && seq != last+1 {
+		onGap := s.OnSequenceGap
+		if onGap == nil {
+			onGap = logSequenceGap
+		}
+		onGap(topic, last+1, seq)
+	}
+	if seq > last {
+		s.lastSequence[topic] = seq
+	}
+}
+
+func logSequenceGap(topic string, expected, got int64) {
+	fmt.Printf("Sequence gap on %s: expected %d, got %d\n", topic, expected, got)
+}
+
+func (s *Subscriber[T]) deadLetter(ctx context.Context, msg *redis.Message, cause error) {
+	if s.DeadLetters == nil {
+		return
+	}
+	if err := s.DeadLetters.Push(ctx, msg.Channel, msg.Payload, cause); err != nil {
+		fmt.Println("Failed to dead-letter message:", err)
+	}
+}
+
+func printMessage[T any](ctx context.Context, data T) error {
+	fmt.Printf("Received - %+v\n", data)
+	return nil
+}
+
+func logError(ctx context.Context, err error) {
+	fmt.Println("Failed to handle message:", err)
+}
+
+func printProductMessage(ctx context.Context, data ProductMessage) error {
+	fmt.Printf("Received - Product ID: %d, Name: %s, Action: %s\n",
+		data.Product.ID, data.Product.Name, data.Action)
+	return nil
+}
+
 func (p *Publisher) Publish(ctx context.Context, topic string, message string) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second) // Set timeout for publishing
+	_, err := p.PublishWithCount(ctx, topic, message)
+	return err
+}
+
+// PublishWithCount publishes message and returns the number of subscribers that received it.
+// Redis pub/sub does not keep messages, so a count of 0 means the message was lost.
+func (p *Publisher) PublishWithCount(ctx context.Context, topic string, message string) (int64, error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout) // Set timeout for publishing
 	defer cancel()
 
-	err := p.Redis.Publish(ctx, topic, message).Err()
+	if p.Metrics != nil {
+		now := p.now
+		if now == nil {
+			now = time.Now
+		}
+		start := now()
+		defer func() {
+			p.Metrics.Observe(MetricPublishDuration, now().Sub(start), map[string]string{"topic": topic})
+		}()
+	}
+
+	receivers, err := p.Redis.Publish(ctx, topic, message).Result()
 	if err != nil {
-		log.Println("Failed to publish message:", err)
+		log.Println("Failed to publish message:", err, "payload:", p.Redactor.Redact(message))
 	}
-	return err
+	return receivers, err
+}
+
+// PublishJSON marshals v with the package codec and publishes the bytes on topic.
+func (p *Publisher) PublishJSON(ctx context.Context, topic string, v any) error {
+	msgBytes, err := codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return p.Publish(ctx, topic, string(msgBytes))
+}
+
+// PublishMessage publishes msg on topic wrapped in its versioned Envelope, so subscribers
+// can dispatch on the schema version.
+func (p *Publisher) PublishMessage(ctx context.Context, topic string, msg *ProductMessage) error {
+	msgBytes, err := msg.ToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return p.Publish(ctx, topic, string(msgBytes))
+}
+
+// PublishSequenced stamps msg with the next sequence number of the topic, taken from
+// a Redis INCR counter, and publishes it. Subscribers use it to detect gaps and reordering.
+func (p *Publisher) PublishSequenced(ctx context.Context, topic string, msg *ProductMessage) error {
+	seq, err := p.Redis.Incr(ctx, sequenceKey(topic)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get sequence number: %w", err)
+	}
+	msg.Sequence = seq
+
+	return p.PublishMessage(ctx, topic, msg)
+}
+
+func sequenceKey(topic string) string {
+	return fmt.Sprintf("sequence:%s", topic)
 }
 
 type Product struct {
@@ -87,6 +491,14 @@ type Product struct {
 type ProductMessage struct {
 	Product *Product `json:"product"`
 	Action  string   `json:"action"`
+	// Sequence increases by one per published message on a topic, 0 means unsequenced.
+	Sequence int64 `json:"sequence,omitempty"`
+	// Version is the schema version ToBytes puts on the envelope, 0 means ProductMessageVersion.
+	Version int `json:"-"`
+}
+
+func (p ProductMessage) SequenceNumber() int64 {
+	return p.Sequence
 }
 
 func NewProduct(id int, name string) *Product {
@@ -94,11 +506,23 @@ func NewProduct(id int, name string) *Product {
 }
 
 func NewProductMessage(product *Product, action string) *ProductMessage {
-	return &ProductMessage{Product: product, Action: action}
+	return &ProductMessage{Product: product, Action: action, Version: ProductMessageVersion}
 }
 
+// ToBytes encodes the message wrapped in an Envelope.
 func (p *ProductMessage) ToBytes() ([]byte, error) {
-	return json.Marshal(p)
+	version := p.Version
+	if version == 0 {
+		version = ProductMessageVersion
+	}
+	if pooled, ok := codec.(*PooledJSONCodec); ok {
+		return pooled.marshalEnvelope(version, p)
+	}
+	env, err := NewEnvelope(version, p)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(env)
 }
 
 func main() {
@@ -108,7 +532,10 @@ func main() {
 		Addr:     "localhost:6379",
 		Password: "", // No password
 		DB:       0,  // Default DB
+		// RetryHook retries the idempotent commands instead
+		MaxRetries: -1,
 	})
+	rdb.AddHook(NewRetryHook(3, 100*time.Millisecond))
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
 		fmt.Println("Failed to connect to Redis:", err)
@@ -116,23 +543,18 @@ func main() {
 	}
 	fmt.Println("Connected to Redis")
 
-	productSub := NewSubscriber(rdb, "product")
+	productSub := NewSubscriber[ProductMessage](rdb, "product")
+	productSub.OnMessage = printProductMessage
 	productPub := NewPublisher(rdb)
 
 	ctx, cancel := context.WithCancel(ctx)
 	go productSub.Listen(ctx)
 
-	// Publish a test message
-	time.Sleep(1 * time.Second) // Give some time for subscriber to start
+	// Publish a test message once the subscription is active
+	<-productSub.Ready()
 
 	product := NewProduct(1, "Laptop")
-	productBytes, err := NewProductMessage(product, "create").ToBytes()
-	if err != nil {
-		fmt.Println("Failed to marshal product message:", err)
-		return
-	}
-
-	err = productPub.Publish(ctx, "product", string(productBytes))
+	err := productPub.PublishMessage(ctx, "product", NewProductMessage(product, "create"))
 	if err != nil {
 		fmt.Println("Failed to publish message:", err)
 		return
@@ -140,13 +562,7 @@ func main() {
 	fmt.Println("Message published")
 
 	productTwo := NewProduct(2, "Laptop A")
-	productTwoBytes, err := NewProductMessage(productTwo, "update").ToBytes()
-	if err != nil {
-		fmt.Println("Failed to marshal product message:", err)
-		return
-	}
-
-	err = productPub.Publish(ctx, "product", string(productTwoBytes))
+	err = productPub.PublishMessage(ctx, "product", NewProductMessage(productTwo, "update"))
 	if err != nil {
 		fmt.Println("Failed to publish message:", err)
 		return
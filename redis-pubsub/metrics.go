@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metric names recorded by the publisher and subscribers.
+const (
+	MetricProcessingDuration = "subscriber_processing_duration"
+	// MetricPublishDuration is the time spent in the Redis PUBLISH call, labeled by topic.
+	MetricPublishDuration = "publisher_publish_duration"
+	// MetricDecodeDuration is the time spent decoding a payload, labeled by topic.
+	MetricDecodeDuration = "subscriber_decode_duration"
+)
+
+// MetricsSink receives measurements. Every component treats a nil sink as disabled.
+type MetricsSink interface {
+	Observe(metric string, value time.Duration, labels map[string]string)
+}
+
+// Summary describes the observations recorded for a metric.
+type Summary struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// InMemoryMetrics is a MetricsSink keeping every observation in memory, handy for
+// tests and for dumping a summary at the end of a run.
+type InMemoryMetrics struct {
+	mu           sync.Mutex
+	observations map[string][]time.Duration
+}
+
+func NewInMemoryMetrics() *InMemoryMetrics {
+	return &InMemoryMetrics{
+		observations: make(map[string][]time.Duration),
+	}
+}
+
+func metricKey(metric string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := metric
+	for _, name := range names {
+		key += "," + name + "=" + labels[name]
+	}
+	return key
+}
+
+func (m *InMemoryMetrics) Observe(metric string, value time.Duration, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metricKey(metric, labels)
+	m.observations[key] = append(m.observations[key], value)
+}
+
+// Observations returns a copy of the values recorded for a metric and label set.
+func (m *InMemoryMetrics) Observations(metric string, labels map[string]string) []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Duration(nil), m.observations[metricKey(metric, labels)]...)
+}
+
+// Summary summarizes the values recorded for a metric and label set.
+func (m *InMemoryMetrics) Summary(metric string, labels map[string]string) Summary {
+	values := m.Observations(metric, labels)
+	if len(values) == 0 {
+		return Summary{}
+	}
+
+	summary := Summary{Count: len(values), Min: values[0], Max: values[0]}
+	var total time.Duration
+	for _, v := range values {
+		total += v
+		summary.Min = min(summary.Min, v)
+		summary.Max = max(summary.Max, v)
+	}
+	summary.Mean = total / time.Duration(len(values))
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	summary.P50 = percentile(values, 0.50)
+	summary.P95 = percentile(values, 0.95)
+	summary.P99 = percentile(values, 0.99)
+	return summary
+}
+
+// percentile returns the nearest-rank p percentile of the sorted values.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSubscriber_RecordsProcessingDuration(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const slowDelay = 100 * time.Millisecond
+	metrics := NewInMemoryMetrics()
+	handled := make(chan struct{}, 2)
+
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.Metrics = metrics
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		if data.Action == "slow" {
+			time.Sleep(slowDelay)
+		}
+		handled <- struct{}{}
+		return nil
+	}
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "product")
+
+	for _, action := range []string{"slow", "fast"} {
+		payload, err := NewProductMessage(NewProduct(1, "Laptop"), action).ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rdb.Publish(ctx, "product", payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-time.After(2 * time.Second):
+			t.Fatal("messages were not handled")
+		}
+	}
+
+	labels := map[string]string{"topic": "product"}
+	deadline := time.Now().Add(time.Second)
+	for len(metrics.Observations(MetricProcessingDuration, labels)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	durations := metrics.Observations(MetricProcessingDuration, labels)
+	if len(durations) != 2 {
+		t.Fatalf("expected 2 observations, got %d", len(durations))
+	}
+	if durations[0] < slowDelay {
+		t.Errorf("slow message recorded %v, expected at least %v", durations[0], slowDelay)
+	}
+	if durations[1] >= slowDelay {
+		t.Errorf("fast message recorded %v, expected well below %v", durations[1], slowDelay)
+	}
+
+	summary := metrics.Summary(MetricProcessingDuration, labels)
+	if summary.Count != 2 || summary.Max != durations[0] || summary.Min != durations[1] {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestPublisher_RecordsPublishDuration(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	metrics := NewInMemoryMetrics()
+
+	// every reading of the fake clock advances it by 5ms
+	clock := time.Unix(0, 0)
+	pub := NewPublisher(rdb)
+	pub.Metrics = metrics
+	pub.now = func() time.Time {
+		clock = clock.Add(5 * time.Millisecond)
+		return clock
+	}
+
+	if err := pub.Publish(context.Background(), "product", "payload"); err != nil {
+		t.Fatal(err)
+	}
+
+	durations := metrics.Observations(MetricPublishDuration, map[string]string{"topic": "product"})
+	if len(durations) != 1 || durations[0] != 5*time.Millisecond {
+		t.Fatalf("expected a single 5ms observation for the product topic, got %v", durations)
+	}
+	if other := metrics.Observations(MetricPublishDuration, map[string]string{"topic": "order"}); len(other) != 0 {
+		t.Fatalf("expected no observations for another topic, got %v", other)
+	}
+}
+
+func TestPublisher_NoMetricsSink(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	pub := NewPublisher(rdb)
+	pub.now = func() time.Time {
+		t.Fatal("the clock is read without a metrics sink")
+		return time.Time{}
+	}
+
+	if err := pub.Publish(context.Background(), "product", "payload"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscriber_RecordsDecodeDuration(t *testing.T) {
+	metrics := NewInMemoryMetrics()
+	sub := NewSubscriber[ProductMessage](nil, "product")
+	sub.Metrics = metrics
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error { return nil }
+
+	payload := func(name string) string {
+		p, err := NewProductMessage(NewProduct(1, name), "create").ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(p)
+	}
+	small := payload("Laptop")
+	large := payload(strings.Repeat("Laptop ", 100_000))
+
+	const runs = 20
+	for i := 0; i < runs; i++ {
+		sub.handle(context.Background(), &redis.Message{Channel: "small", Payload: small})
+		sub.handle(context.Background(), &redis.Message{Channel: "large", Payload: large})
+	}
+
+	smallSummary := metrics.Summary(MetricDecodeDuration, map[string]string{"topic": "small"})
+	largeSummary := metrics.Summary(MetricDecodeDuration, map[string]string{"topic": "large"})
+	if smallSummary.Count != runs || largeSummary.Count != runs {
+		t.Fatalf("expected %d observations per topic, got %d and %d", runs, smallSummary.Count, largeSummary.Count)
+	}
+	if largeSummary.Mean <= smallSummary.Mean {
+		t.Fatalf("expected large payloads to decode slower on average, got %v for large and %v for small",
+			largeSummary.Mean, smallSummary.Mean)
+	}
+}
+
+func TestInMemoryMetrics_SummaryPercentiles(t *testing.T) {
+	metrics := NewInMemoryMetrics()
+	// observed out of order, 1ms to 100ms
+	for i := 100; i >= 1; i-- {
+		metrics.Observe("latency", time.Duration(i)*time.Millisecond, nil)
+	}
+
+	summary := metrics.Summary("latency", nil)
+	if summary.P50 != 50*time.Millisecond || summary.P95 != 95*time.Millisecond || summary.P99 != 99*time.Millisecond {
+		t.Fatalf("unexpected percentiles %+v", summary)
+	}
+}
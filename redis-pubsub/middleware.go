@@ -0,0 +1,25 @@
+package main
+
+import "context"
+
+// Handler processes a decoded message, the signature of Subscriber.OnMessage.
+type Handler[T any] func(ctx context.Context, data T) error
+
+// Middleware wraps a Handler to add a cross-cutting concern such as logging, metrics or
+// recovery. It may return without calling next to short-circuit the message.
+type Middleware[T any] func(next Handler[T]) Handler[T]
+
+// Use appends mw to the middlewares wrapping OnMessage. The first middleware is the
+// outermost one, so middlewares run in the order they were added. Use must be called
+// before Listen.
+func (s *Subscriber[T]) Use(mw ...Middleware[T]) {
+	s.middlewares = append(s.middlewares, mw...)
+}
+
+// chain wraps handler with the middlewares, the first one outermost.
+func (s *Subscriber[T]) chain(handler Handler[T]) Handler[T] {
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		handler = s.middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSubscriber_Use(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware[testOrder] {
+		return func(next Handler[testOrder]) Handler[testOrder] {
+			return func(ctx context.Context, data testOrder) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, data)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+
+	sub := NewSubscriber[testOrder](nil, "order")
+	sub.OnMessage = func(ctx context.Context, data testOrder) error {
+		calls = append(calls, "handler "+data.ID)
+		return nil
+	}
+	sub.Use(record("first"), record("second"))
+
+	sub.handle(context.Background(), &redis.Message{Channel: "order", Payload: `{"id":"ord-1","total":10}`})
+
+	want := []string{"first before", "second before", "handler ord-1", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+}
+
+func TestSubscriber_UseShortCircuit(t *testing.T) {
+	errBlocked := errors.New("blocked")
+	var handled bool
+	var handleErr error
+
+	sub := NewSubscriber[testOrder](nil, "order")
+	sub.OnMessage = func(ctx context.Context, data testOrder) error {
+		handled = true
+		return nil
+	}
+	sub.OnError = func(ctx context.Context, err error) {
+		handleErr = err
+	}
+	sub.Use(func(next Handler[testOrder]) Handler[testOrder] {
+		return func(ctx context.Context, data testOrder) error {
+			if data.Total < 0 {
+				return errBlocked
+			}
+			return next(ctx, data)
+		}
+	})
+
+	sub.handle(context.Background(), &redis.Message{Channel: "order", Payload: `{"id":"ord-1","total":-1}`})
+
+	if handled {
+		t.Fatal("expected the middleware to stop the message before the handler")
+	}
+	if !errors.Is(handleErr, errBlocked) {
+		t.Fatalf("expected the middleware error to reach OnError, got %v", handleErr)
+	}
+
+	sub.handle(context.Background(), &redis.Message{Channel: "order", Payload: `{"id":"ord-2","total":5}`})
+	if !handled {
+		t.Fatal("expected the handler to run when the middleware lets the message through")
+	}
+}
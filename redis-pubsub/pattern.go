@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PatternMessage is a decoded message received through a pattern subscription.
+type PatternMessage[T any] struct {
+	// Channel is the concrete topic the message was published on, e.g. product.created.
+	Channel string
+	// Pattern is the subscribed pattern that matched Channel, e.g. product.*.
+	Pattern string
+	Data    T
+}
+
+// PatternSubscriber decodes the JSON messages of every topic matching one of its
+// glob-style patterns into T and hands them to OnMessage.
+type PatternSubscriber[T any] struct {
+	Redis    redis.UniversalClient
+	Patterns []string
+	// OnMessage processes each decoded message, it defaults to printing the message.
+	OnMessage func(ctx context.Context, msg PatternMessage[T]) error
+	// OnError receives decode errors and the errors returned by OnMessage, it defaults to logging them.
+	OnError func(ctx context.Context, err error)
+}
+
+func NewPatternSubscriber[T any](rdb redis.UniversalClient, patterns ...string) *PatternSubscriber[T] {
+	return &PatternSubscriber[T]{
+		Redis:    rdb,
+		Patterns: patterns,
+	}
+}
+
+// Listen subscribes to the patterns and processes messages until ctx is cancelled.
+func (s *PatternSubscriber[T]) Listen(ctx context.Context) error {
+	fmt.Println("Listening for messages matching", s.Patterns)
+	pubSub := s.Redis.PSubscribe(ctx, s.Patterns...)
+	defer pubSub.Close()
+
+	if _, err := pubSub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to subscribe to patterns: %w", err)
+	}
+
+	ch := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Subscriber shutting down...")
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				fmt.Println("Channel closed")
+				return nil
+			}
+			s.handle(ctx, msg)
+		}
+	}
+}
+
+func (s *PatternSubscriber[T]) handle(ctx context.Context, msg *redis.Message) {
+	onError := s.OnError
+	if onError == nil {
+		onError = logError
+	}
+
+	decoded := PatternMessage[T]{Channel: msg.Channel, Pattern: msg.Pattern}
+	if err := unmarshalMessage([]byte(msg.Payload), &decoded.Data); err != nil {
+		onError(ctx, fmt.Errorf("failed to unmarshal message on %s: %w", msg.Channel, err))
+		return
+	}
+
+	onMessage := s.OnMessage
+	if onMessage == nil {
+		onMessage = printMessage[PatternMessage[T]]
+	}
+	if err := onMessage(ctx, decoded); err != nil {
+		onError(ctx, fmt.Errorf("failed to handle message on %s: %w", msg.Channel, err))
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPatternSubscriber_SurfacesMatchedChannel(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan PatternMessage[ProductMessage], 2)
+	sub := NewPatternSubscriber[ProductMessage](rdb, "product.*")
+	sub.OnMessage = func(ctx context.Context, msg PatternMessage[ProductMessage]) error {
+		received <- msg
+		return nil
+	}
+	go sub.Listen(ctx)
+
+	// wait for the pattern subscription before publishing
+	deadline := time.Now().Add(2 * time.Second)
+	for rdb.PubSubNumPat(ctx).Val() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for _, tc := range []struct {
+		channel string
+		action  string
+	}{
+		{"product.created", "create"},
+		{"product.updated", "update"},
+		{"order.created", "create"},
+	} {
+		payload, err := NewProductMessage(NewProduct(1, "Laptop"), tc.action).ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rdb.Publish(ctx, tc.channel, payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []struct {
+		channel string
+		action  string
+	}{
+		{"product.created", "create"},
+		{"product.updated", "update"},
+	} {
+		select {
+		case msg := <-received:
+			if msg.Channel != want.channel || msg.Pattern != "product.*" || msg.Data.Action != want.action {
+				t.Fatalf("expected %s matched by product.*, got %+v", want.channel, msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message on %s was not received", want.channel)
+		}
+	}
+
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message from a non-matching channel: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPublisher_PublishJSON(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	pubsub := rdb.Subscribe(ctx, "product")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	pub := NewPublisher(rdb)
+	if err := pub.PublishJSON(ctx, "product", NewProductMessage(NewProduct(1, "Laptop"), "create")); err != nil {
+		t.Fatalf("PublishJSON returned error: %v", err)
+	}
+
+	msg, err := pubsub.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive message: %v", err)
+	}
+
+	var got ProductMessage
+	if err := json.Unmarshal([]byte(msg.Payload), &got); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if got.Product.ID != 1 || got.Action != "create" {
+		t.Errorf("unexpected message: %+v", got)
+	}
+}
+
+func TestPublisher_PublishMessage(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	pubsub := rdb.Subscribe(ctx, "product")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	pub := NewPublisher(rdb)
+	if err := pub.PublishMessage(ctx, "product", NewProductMessage(NewProduct(1, "Laptop"), "create")); err != nil {
+		t.Fatalf("PublishMessage returned error: %v", err)
+	}
+
+	msg, err := pubsub.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive message: %v", err)
+	}
+
+	env, ok := openEnvelope([]byte(msg.Payload))
+	if !ok || env.Version != ProductMessageVersion {
+		t.Fatalf("expected a version %d envelope, got %s", ProductMessageVersion, msg.Payload)
+	}
+	var got ProductMessage
+	if err := json.Unmarshal(env.Payload, &got); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if got.Product.ID != 1 || got.Action != "create" {
+		t.Errorf("unexpected message: %+v", got)
+	}
+}
+
+func TestPublisher_PublishJSONMarshalError(t *testing.T) {
+	_, rdb := newTestRedis(t)
+
+	pub := NewPublisher(rdb)
+	if err := pub.PublishJSON(context.Background(), "product", make(chan int)); err == nil {
+		t.Fatal("expected marshal error")
+	}
+}
+
+func TestPublisher_Timeout(t *testing.T) {
+	// A server that accepts connections but never replies, so only the timeout ends the publish.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:                  ln.Addr().String(),
+		MaxRetries:            -1,
+		ContextTimeoutEnabled: true,
+		// RESP2 without identity commands so no handshake runs before the publish.
+		Protocol:         2,
+		DisableIndentity: true,
+	})
+	defer rdb.Close()
+
+	pub := NewPublisher(rdb)
+	pub.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err = pub.Publish(context.Background(), "product", "{}")
+	var netErr net.Error
+	if !errors.Is(err, context.DeadlineExceeded) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("publish took %v, expected it to be bounded by the timeout", elapsed)
+	}
+}
+
+func TestPublisher_PublishWithCount(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+	pub := NewPublisher(rdb)
+
+	count, err := pub.PublishWithCount(ctx, "product", "{}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected no receivers without subscribers, got %d", count)
+	}
+
+	for i := 0; i < 2; i++ {
+		pubsub := rdb.Subscribe(ctx, "product")
+		defer pubsub.Close()
+		if _, err := pubsub.Receive(ctx); err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+	}
+
+	count, err = pub.PublishWithCount(ctx, "product", "{}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 receivers, got %d", count)
+	}
+}
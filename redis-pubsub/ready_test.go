@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscriber_Ready(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan ProductMessage, 1)
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		received <- data
+		return nil
+	}
+
+	select {
+	case <-sub.Ready():
+		t.Fatal("Ready closed before Listen subscribed")
+	default:
+	}
+
+	go sub.Listen(ctx)
+
+	select {
+	case <-sub.Ready():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Ready was never closed")
+	}
+
+	// publishing right after Ready must not lose the message
+	payload, err := NewProductMessage(NewProduct(1, "Laptop"), "create").ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receivers, err := rdb.Publish(ctx, "product", payload).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receivers != 1 {
+		t.Fatalf("expected 1 receiver once ready, got %d", receivers)
+	}
+
+	select {
+	case data := <-received:
+		if data.Product.ID != 1 {
+			t.Fatalf("unexpected message: %+v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message published after Ready was not received")
+	}
+}
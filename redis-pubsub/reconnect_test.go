@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSubscriber_ReconnectsAfterChannelClose(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan ProductMessage, 2)
+	subscriptions := make(chan *redis.PubSub, 2)
+
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.ReconnectBackoff = Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2}
+	sub.subscribed = func(pubSub *redis.PubSub) { subscriptions <- pubSub }
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		received <- data
+		return nil
+	}
+	go sub.Listen(ctx)
+
+	publish := func(id int) {
+		t.Helper()
+		waitForSubscriber(t, mr, "product")
+		payload, err := NewProductMessage(NewProduct(id, "Laptop"), "create").ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rdb.Publish(ctx, "product", payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case data := <-received:
+			if data.Product.ID != id {
+				t.Fatalf("expected product %d, got %d", id, data.Product.ID)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("product %d was not received", id)
+		}
+	}
+
+	first := <-subscriptions
+	publish(1)
+
+	// drop the subscription, Listen has to subscribe again instead of returning
+	first.Close()
+
+	select {
+	case <-subscriptions:
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not reconnect")
+	}
+	publish(2)
+}
+
+func TestBackoff_Next(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 3}
+
+	delays := []time.Duration{b.Initial}
+	for i := 0; i < 3; i++ {
+		delays = append(delays, b.Next(delays[len(delays)-1]))
+	}
+
+	want := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Fatalf("delay %d: expected %v, got %v", i, want[i], delays[i])
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import "strings"
+
+// redactedValue replaces the value of every redacted field.
+const redactedValue = "[REDACTED]"
+
+// Redactor masks sensitive JSON fields of payloads before they are logged. Paths are
+// dot separated field names relative to the message, e.g. "email" or "product.name",
+// enveloped payloads are redacted inside their envelope. Arrays along a path have the
+// field masked in every element.
+type Redactor struct {
+	Paths [][]string
+}
+
+func NewRedactor(paths ...string) *Redactor {
+	r := &Redactor{}
+	for _, path := range paths {
+		r.Paths = append(r.Paths, strings.Split(path, "."))
+	}
+	return r
+}
+
+// Redact returns payload with the configured fields masked. A nil Redactor returns it
+// unchanged. Payloads that are not JSON cannot be inspected and are masked entirely.
+func (r *Redactor) Redact(payload string) string {
+	if r == nil || len(r.Paths) == 0 {
+		return payload
+	}
+
+	if env, ok := openEnvelope([]byte(payload)); ok {
+		body, ok := r.redact(env.Payload)
+		if !ok {
+			return redactedValue
+		}
+		env.Payload = body
+		data, err := codec.Marshal(env)
+		if err != nil {
+			return redactedValue
+		}
+		return string(data)
+	}
+
+	body, ok := r.redact([]byte(payload))
+	if !ok {
+		return redactedValue
+	}
+	return string(body)
+}
+
+func (r *Redactor) redact(data []byte) ([]byte, bool) {
+	var v any
+	if err := codec.Unmarshal(data, &v); err != nil {
+		return nil, false
+	}
+	for _, path := range r.Paths {
+		maskPath(v, path)
+	}
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func maskPath(v any, path []string) {
+	switch v := v.(type) {
+	case map[string]any:
+		field, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			v[path[0]] = redactedValue
+			return
+		}
+		maskPath(field, path[1:])
+	case []any:
+		for _, elem := range v {
+			maskPath(elem, path)
+		}
+	}
+}
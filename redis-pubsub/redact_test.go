@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// captureStdout returns what fn prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestRedactor_Redact(t *testing.T) {
+	redactor := NewRedactor("email", "product.name", "items.sku")
+
+	t.Run("plain payload", func(t *testing.T) {
+		got := redactor.Redact(`{"email":"john@example.com","product":{"id":1,"name":"Laptop"},"items":[{"sku":"a","qty":1},{"sku":"b","qty":2}],"action":"create"}`)
+
+		var v map[string]any
+		if err := json.Unmarshal([]byte(got), &v); err != nil {
+			t.Fatalf("redacted payload is not JSON: %v", err)
+		}
+		want := `{"action":"create","email":"[REDACTED]","items":[{"qty":1,"sku":"[REDACTED]"},{"qty":2,"sku":"[REDACTED]"}],"product":{"id":1,"name":"[REDACTED]"}}`
+		if got != want {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	})
+
+	t.Run("enveloped payload", func(t *testing.T) {
+		payload, err := NewProductMessage(NewProduct(1, "Laptop"), "create").ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := redactor.Redact(string(payload))
+		if strings.Contains(got, "Laptop") {
+			t.Fatalf("expected the product name to be masked, got %s", got)
+		}
+		var data ProductMessage
+		if err := unmarshalMessage([]byte(got), &data); err != nil {
+			t.Fatalf("expected the envelope to be kept, got %v", err)
+		}
+		if data.Product.ID != 1 || data.Product.Name != redactedValue || data.Action != "create" {
+			t.Fatalf("unexpected redacted message: %+v", data)
+		}
+	})
+
+	t.Run("not JSON", func(t *testing.T) {
+		if got := redactor.Redact("email=john@example.com"); got != redactedValue {
+			t.Fatalf("expected the whole payload to be masked, got %s", got)
+		}
+	})
+
+	t.Run("nil redactor", func(t *testing.T) {
+		var nilRedactor *Redactor
+		if got := nilRedactor.Redact(`{"email":"john@example.com"}`); got != `{"email":"john@example.com"}` {
+			t.Fatalf("expected the payload unchanged, got %s", got)
+		}
+	})
+}
+
+func TestSubscriber_LogsRedactedPayload(t *testing.T) {
+	sub := NewSubscriber[ProductMessage](nil, "product")
+	sub.Redactor = NewRedactor("email", "product.name")
+
+	// the id has the wrong type, so the payload is logged as undecodable
+	payload := `{"product":{"id":"one","name":"Laptop"},"email":"john@example.com","action":"create"}`
+	out := captureStdout(t, func() {
+		sub.handle(context.Background(), &redis.Message{Channel: "product", Payload: payload})
+	})
+
+	if !strings.Contains(out, "Failed to unmarshal message") {
+		t.Fatalf("expected the payload to be logged, got %q", out)
+	}
+	for _, secret := range []string{"Laptop", "john@example.com"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %s to be masked, got %q", secret, out)
+		}
+	}
+	for _, visible := range []string{`"action":"create"`, `"id":"one"`} {
+		if !strings.Contains(out, visible) {
+			t.Errorf("expected %s to stay visible, got %q", visible, out)
+		}
+	}
+}
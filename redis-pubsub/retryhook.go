@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// idempotentCommands are the commands RetryHook may run more than once, running them
+// again after a lost reply has the same effect as running them once. Writes such as
+// INCR, PUBLISH or GETDEL would apply twice and are never retried.
+var idempotentCommands = map[string]bool{
+	"get":       true,
+	"mget":      true,
+	"exists":    true,
+	"ttl":       true,
+	"pttl":      true,
+	"type":      true,
+	"strlen":    true,
+	"hget":      true,
+	"hmget":     true,
+	"hgetall":   true,
+	"hexists":   true,
+	"hlen":      true,
+	"smembers":  true,
+	"sismember": true,
+	"scard":     true,
+	"lrange":    true,
+	"llen":      true,
+	"zrange":    true,
+	"zscore":    true,
+	"zcard":     true,
+	"xrange":    true,
+	"xrevrange": true,
+	"xlen":      true,
+	"ping":      true,
+}
+
+// RetryHook is a go-redis hook retrying idempotent commands that failed with a transient
+// network error, waiting Backoff, doubled per retry, in between. It is installed once on
+// the shared client with AddHook. The client's own MaxRetries retries every command, so
+// it should be disabled with MaxRetries: -1 when the hook is used.
+type RetryHook struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+func NewRetryHook(maxAttempts int, backoff time.Duration) *RetryHook {
+	return &RetryHook{
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+	}
+}
+
+func (h *RetryHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *RetryHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if !idempotentCommands[strings.ToLower(cmd.Name())] {
+			return err
+		}
+
+		delay := h.Backoff
+		for attempt := 1; attempt < h.MaxAttempts && isTransientError(err); attempt++ {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			delay *= 2
+			err = next(ctx, cmd)
+		}
+		return err
+	}
+}
+
+// ProcessPipelineHook leaves pipelines alone, they may mix idempotent and other commands.
+func (h *RetryHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// isTransientError reports whether err is a network failure that may not happen again,
+// as opposed to an error reply from Redis or a cancelled context.
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// failOnceHook fails the first call of every command with a connection reset before it
+// reaches Redis, and counts how often each command was processed.
+type failOnceHook struct {
+	calls map[string]int
+}
+
+func (h *failOnceHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *failOnceHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.calls[cmd.Name()]++
+		if h.calls[cmd.Name()] == 1 {
+			return &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *failOnceHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRetryHook(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+
+	mr.Set("product:1", "Laptop")
+	mr.Set("counter", "0")
+
+	// hooks added first run first, so the retry hook wraps the failing one
+	rdb.AddHook(NewRetryHook(3, time.Millisecond))
+	failing := &failOnceHook{calls: make(map[string]int)}
+	rdb.AddHook(failing)
+
+	val, err := rdb.Get(ctx, "product:1").Result()
+	if err != nil {
+		t.Fatalf("expected GET to be retried, got %v", err)
+	}
+	if val != "Laptop" {
+		t.Fatalf("expected Laptop, got %q", val)
+	}
+	if failing.calls["get"] != 2 {
+		t.Fatalf("expected GET to be sent twice, got %d", failing.calls["get"])
+	}
+
+	err = rdb.Incr(ctx, "counter").Err()
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		t.Fatalf("expected INCR to return the network error, got %v", err)
+	}
+	if failing.calls["incr"] != 1 {
+		t.Fatalf("expected INCR to be sent once, got %d", failing.calls["incr"])
+	}
+	if got, _ := mr.Get("counter"); got != "0" {
+		t.Fatalf("expected the counter to be untouched, got %s", got)
+	}
+}
+
+func TestRetryHook_RedisErrorsAreNotRetried(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+
+	mr.HSet("product:1", "name", "Laptop")
+	rdb.AddHook(NewRetryHook(3, time.Millisecond))
+
+	// a WRONGTYPE reply is final, retrying it would only fail again
+	err := rdb.Get(context.Background(), "product:1").Err()
+	if err == nil || isTransientError(err) {
+		t.Fatalf("expected a non transient WRONGTYPE error, got %v", err)
+	}
+}
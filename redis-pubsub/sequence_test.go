@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type sequenceGap struct {
+	topic         string
+	expected, got int64
+}
+
+func TestPublishSequenced_DetectsGap(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan ProductMessage, 10)
+	gaps := make(chan sequenceGap, 10)
+
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		received <- data
+		return nil
+	}
+	sub.OnSequenceGap = func(topic string, expected, got int64) {
+		gaps <- sequenceGap{topic: topic, expected: expected, got: got}
+	}
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "product")
+
+	pub := NewPublisher(rdb)
+	for i := 1; i <= 3; i++ {
+		if err := pub.PublishSequenced(ctx, "product", NewProductMessage(NewProduct(i, "Laptop"), "create")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for want := int64(1); want <= 3; want++ {
+		select {
+		case data := <-received:
+			if data.Sequence != want {
+				t.Fatalf("expected sequence %d, got %d", want, data.Sequence)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+
+	// simulate a lost message by burning sequence 4
+	if err := rdb.Incr(ctx, sequenceKey("product")).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.PublishSequenced(ctx, "product", NewProductMessage(NewProduct(5, "Laptop"), "create")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case gap := <-gaps:
+		if gap != (sequenceGap{topic: "product", expected: 4, got: 5}) {
+			t.Fatalf("unexpected gap %+v", gap)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("gap was not flagged")
+	}
+	if len(gaps) != 0 {
+		t.Fatalf("expected a single gap, got %d more", len(gaps))
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// streamPayloadField is the stream entry field holding the JSON encoded message.
+const streamPayloadField = "payload"
+
+// StreamSubscriber consumes a Redis Stream as part of a consumer group. Entries are only
+// acknowledged once the handler succeeds, so entries left pending by a consumer that
+// went away can be claimed and processed by the remaining consumers.
+type StreamSubscriber struct {
+	Redis    redis.UniversalClient
+	Stream   string
+	Group    string
+	Consumer string
+	// Handler processes each decoded message, it defaults to printing the message.
+	Handler func(ctx context.Context, data ProductMessage) error
+	// MinIdleTime is how long an entry has to be pending before this consumer claims it from a peer.
+	MinIdleTime time.Duration
+	// Block is how long a single XREADGROUP waits for new entries.
+	Block time.Duration
+	// Count is the maximum number of entries fetched per XREADGROUP.
+	Count int64
+	// AckEvery acknowledges processed entries in groups of this size. Larger groups mean
+	// fewer round trips, but more entries are redelivered if the consumer crashes.
+	AckEvery int
+	// AckInterval acknowledges processed entries at least this often, even if fewer
+	// than AckEvery are waiting. 0 only acknowledges on AckEvery and on shutdown.
+	AckInterval time.Duration
+
+	pendingAcks []string
+	lastAck     time.Time
+}
+
+func NewStreamSubscriber(rdb redis.UniversalClient, stream, group, consumer string) *StreamSubscriber {
+	return &StreamSubscriber{
+		Redis:       rdb,
+		Stream:      stream,
+		Group:       group,
+		Consumer:    consumer,
+		MinIdleTime: 30 * time.Second,
+		Block:       time.Second,
+		Count:       10,
+		AckEvery:    1,
+	}
+}
+
+// Listen reads and processes entries until ctx is cancelled. On shutdown it stops claiming
+// and reading new entries, anything still pending is left for the other consumers to claim
+// once it has been idle for their MinIdleTime.
+func (s *StreamSubscriber) Listen(ctx context.Context) error {
+	if err := s.ensureGroup(ctx); err != nil {
+		return err
+	}
+
+	fmt.Printf("Consumer %s listening on stream %s...\n", s.Consumer, s.Stream)
+	s.lastAck = time.Now()
+	// acknowledge what was already processed, ctx is cancelled by then
+	defer s.flushAcks(context.Background())
+
+	if err := s.redeliverOwn(ctx); err != nil && ctx.Err() == nil {
+		fmt.Println("Failed to redeliver pending entries:", err)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			fmt.Printf("Consumer %s shutting down...\n", s.Consumer)
+			return nil
+		}
+
+		if s.AckInterval > 0 && time.Since(s.lastAck) >= s.AckInterval {
+			s.flushAcks(ctx)
+		}
+
+		if err := s.claimStale(ctx); err != nil && ctx.Err() == nil {
+			fmt.Println("Failed to claim pending entries:", err)
+		}
+
+		streams, err := s.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.Group,
+			Consumer: s.Consumer,
+			Streams:  []string{s.Stream, ">"},
+			Count:    s.Count,
+			Block:    s.Block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			return fmt.Errorf("failed to read from stream: %w", err)
+		}
+
+		for _, stream := range streams {
+			s.processAll(ctx, stream.Messages)
+		}
+	}
+}
+
+func (s *StreamSubscriber) ensureGroup(ctx context.Context) error {
+	err := s.Redis.XGroupCreateMkStream(ctx, s.Stream, s.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+// redeliverOwn processes the entries still pending on this consumer, e.g. because it
+// crashed before acknowledging them, without waiting for them to become idle.
+func (s *StreamSubscriber) redeliverOwn(ctx context.Context) error {
+	start := "0"
+	for ctx.Err() == nil {
+		streams, err := s.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.Group,
+			Consumer: s.Consumer,
+			Streams:  []string{s.Stream, start},
+			Count:    s.Count,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return nil
+		}
+
+		messages := streams[0].Messages
+		s.processAll(ctx, messages)
+		// entries that failed again stay pending, continue after them rather than retrying in a loop
+		start = messages[len(messages)-1].ID
+	}
+	return nil
+}
+
+// claimStale takes over entries that another consumer left pending for at least MinIdleTime.
+func (s *StreamSubscriber) claimStale(ctx context.Context) error {
+	messages, _, err := s.Redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   s.Stream,
+		Group:    s.Group,
+		Consumer: s.Consumer,
+		MinIdle:  s.MinIdleTime,
+		Start:    "0-0",
+		Count:    s.Count,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	s.processAll(ctx, messages)
+	return nil
+}
+
+func (s *StreamSubscriber) processAll(ctx context.Context, messages []redis.XMessage) {
+	for _, msg := range messages {
+		// entries read after shutdown started stay pending so a peer can claim them
+		if ctx.Err() != nil {
+			return
+		}
+		s.process(ctx, msg)
+	}
+}
+
+func (s *StreamSubscriber) process(ctx context.Context, msg redis.XMessage) {
+	payload, _ := msg.Values[streamPayloadField].(string)
+
+	var data ProductMessage
+	if err := unmarshalMessage([]byte(payload), &data); err != nil {
+		// a payload that cannot be decoded never will be, so it is acknowledged rather than redelivered
+		fmt.Println("Failed to unmarshal stream entry:", err)
+		s.ack(ctx, msg.ID)
+		return
+	}
+
+	handler := s.Handler
+	if handler == nil {
+		handler = printProductMessage
+	}
+	if err := handler(ctx, data); err != nil {
+		fmt.Println("Failed to handle stream entry, leaving it pending:", err)
+		return
+	}
+	s.ack(ctx, msg.ID)
+}
+
+// ack queues id for acknowledgement, the queue is flushed every AckEvery entries.
+func (s *StreamSubscriber) ack(ctx context.Context, id string) {
+	s.pendingAcks = append(s.pendingAcks, id)
+	if len(s.pendingAcks) >= max(s.AckEvery, 1) {
+		s.flushAcks(ctx)
+	}
+}
+
+func (s *StreamSubscriber) flushAcks(ctx context.Context) {
+	s.lastAck = time.Now()
+	if len(s.pendingAcks) == 0 {
+		return
+	}
+
+	if err := s.Redis.XAck(ctx, s.Stream, s.Group, s.pendingAcks...).Err(); err != nil {
+		// the entries stay pending and are redelivered, which at-least-once allows
+		fmt.Println("Failed to acknowledge stream entries:", err)
+	}
+	s.pendingAcks = s.pendingAcks[:0]
+}
+
+// StreamPublisher appends messages to a Redis Stream for StreamSubscriber consumer groups.
+type StreamPublisher struct {
+	Redis redis.UniversalClient
+}
+
+func NewStreamPublisher(rdb redis.UniversalClient) *StreamPublisher {
+	return &StreamPublisher{
+		Redis: rdb,
+	}
+}
+
+// PublishMessage appends msg to stream using the JSON encoding StreamSubscriber expects.
+func (p *StreamPublisher) PublishMessage(ctx context.Context, stream string, msg *ProductMessage) error {
+	msgBytes, err := msg.ToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return p.Publish(ctx, stream, string(msgBytes))
+}
+
+// Publish appends message to stream as the payload field of a new entry.
+func (p *StreamPublisher) Publish(ctx context.Context, stream string, message string) error {
+	err := p.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{streamPayloadField: message},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add stream entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func addStreamEntry(t *testing.T, rdb *redis.Client, stream string, msg *ProductMessage) string {
+	t.Helper()
+	payload, err := msg.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := rdb.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]any{streamPayloadField: payload},
+	}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestStreamSubscriber_PendingHandoffOnShutdown(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	// consumer A reads both entries but shuts down before finishing them
+	readByA := make(chan struct{}, 2)
+	ctxA, cancelA := context.WithCancel(ctx)
+	subA := NewStreamSubscriber(rdb, "product-stream", "workers", "worker-a")
+	subA.Block = 50 * time.Millisecond
+	subA.Handler = func(ctx context.Context, data ProductMessage) error {
+		readByA <- struct{}{}
+		return errors.New("interrupted by shutdown")
+	}
+	if err := subA.ensureGroup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	doneA := make(chan error)
+	go func() { doneA <- subA.Listen(ctxA) }()
+
+	addStreamEntry(t, rdb, "product-stream", NewProductMessage(NewProduct(1, "Laptop"), "create"))
+	addStreamEntry(t, rdb, "product-stream", NewProductMessage(NewProduct(2, "Mouse"), "create"))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-readByA:
+		case <-time.After(2 * time.Second):
+			t.Fatal("consumer A never read the entries")
+		}
+	}
+	cancelA()
+	if err := <-doneA; err != nil {
+		t.Fatalf("consumer A returned an error: %v", err)
+	}
+
+	pending, err := rdb.XPending(ctx, "product-stream", "workers").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Count != 2 || pending.Consumers["worker-a"] != 2 {
+		t.Fatalf("expected 2 entries pending on worker-a, got %+v", pending)
+	}
+
+	// consumer B claims what A left behind once it has been idle long enough
+	var mu sync.Mutex
+	var processedByB []int
+	ctxB, cancelB := context.WithCancel(ctx)
+	defer cancelB()
+	subB := NewStreamSubscriber(rdb, "product-stream", "workers", "worker-b")
+	subB.Block = 50 * time.Millisecond
+	subB.MinIdleTime = 100 * time.Millisecond
+	subB.Handler = func(ctx context.Context, data ProductMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processedByB = append(processedByB, data.Product.ID)
+		return nil
+	}
+	go subB.Listen(ctxB)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		pending, err = rdb.XPending(ctx, "product-stream", "workers").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pending.Count == 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if pending.Count != 0 {
+		t.Fatalf("expected no pending entries, got %d", pending.Count)
+	}
+	if len(processedByB) != 2 || processedByB[0] != 1 || processedByB[1] != 2 {
+		t.Fatalf("expected worker-b to process products 1 and 2, got %v", processedByB)
+	}
+}
+
+func TestStreamSubscriber_CountAndAckCadence(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	pendingCount := func() int64 {
+		t.Helper()
+		pending, err := rdb.XPending(ctx, "product-stream", "workers").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pending.Count
+	}
+
+	for i := 1; i <= 7; i++ {
+		addStreamEntry(t, rdb, "product-stream", NewProductMessage(NewProduct(i, "Laptop"), "create"))
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	processed := make(chan int, 7)
+
+	sub := NewStreamSubscriber(rdb, "product-stream", "workers", "worker-a")
+	sub.Block = 50 * time.Millisecond
+	sub.Count = 5
+	sub.AckEvery = 5
+	sub.Handler = func(ctx context.Context, data ProductMessage) error {
+		if data.Product.ID == 1 {
+			close(started)
+			<-release
+		}
+		processed <- data.Product.ID
+		return nil
+	}
+	// the group starts at the beginning of the stream so the entries above are delivered
+	if err := sub.ensureGroup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	listenCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- sub.Listen(listenCtx) }()
+
+	<-started
+	// the first XREADGROUP delivered exactly Count entries
+	if got := pendingCount(); got != 5 {
+		t.Fatalf("expected 5 entries read by the first call, got %d", got)
+	}
+	close(release)
+
+	for i := 0; i < 7; i++ {
+		select {
+		case <-processed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("entries were not processed")
+		}
+	}
+
+	// the first 5 were acknowledged together, the last 2 wait for a full group
+	deadline := time.Now().Add(time.Second)
+	for pendingCount() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := pendingCount(); got != 2 {
+		t.Fatalf("expected 2 entries awaiting acknowledgement, got %d", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingCount(); got != 0 {
+		t.Fatalf("expected remaining acks to be flushed on shutdown, got %d pending", got)
+	}
+}
+
+func TestStreamSubscriber_RedeliversOwnPendingAfterRestart(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+	pub := NewStreamPublisher(rdb)
+
+	newSub := func(handler func(ctx context.Context, data ProductMessage) error) *StreamSubscriber {
+		sub := NewStreamSubscriber(rdb, "product-stream", "workers", "worker-a")
+		sub.Block = 50 * time.Millisecond
+		// far longer than the test, so only the restart can redeliver the entry
+		sub.MinIdleTime = time.Hour
+		sub.Handler = handler
+		return sub
+	}
+
+	// the first run fails the entry, as if it crashed before acknowledging it
+	failed := make(chan struct{}, 1)
+	first := newSub(func(ctx context.Context, data ProductMessage) error {
+		failed <- struct{}{}
+		return errors.New("crashed")
+	})
+	if err := first.ensureGroup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	firstCtx, cancelFirst := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- first.Listen(firstCtx) }()
+
+	if err := pub.PublishMessage(ctx, "product-stream", NewProductMessage(NewProduct(1, "Laptop"), "create")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-failed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("entry was never delivered")
+	}
+	cancelFirst()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the restarted consumer gets its own pending entry back and acknowledges it
+	redelivered := make(chan ProductMessage, 1)
+	second := newSub(func(ctx context.Context, data ProductMessage) error {
+		redelivered <- data
+		return nil
+	})
+	secondCtx, cancelSecond := context.WithCancel(ctx)
+	go func() { done <- second.Listen(secondCtx) }()
+
+	select {
+	case data := <-redelivered:
+		if data.Product.ID != 1 || data.Action != "create" {
+			t.Fatalf("unexpected message: %+v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending entry was not redelivered after restart")
+	}
+	cancelSecond()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := rdb.XPending(ctx, "product-stream", "workers").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("expected no pending entries, got %d", pending.Count)
+	}
+}
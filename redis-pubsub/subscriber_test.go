@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscriber_GenericPayloadAndOnError(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errRejected := errors.New("order rejected")
+	received := make(chan testOrder, 2)
+	errs := make(chan error, 1)
+
+	sub := NewSubscriber[testOrder](rdb, "order")
+	sub.OnMessage = func(ctx context.Context, data testOrder) error {
+		received <- data
+		if data.Total < 0 {
+			return errRejected
+		}
+		return nil
+	}
+	sub.OnError = func(ctx context.Context, err error) {
+		errs <- err
+	}
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "order")
+
+	for _, payload := range []string{"", `{"id":"ord-1","total":10}`, `{"id":"ord-2","total":-1}`} {
+		if err := rdb.Publish(ctx, "order", payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []testOrder{{ID: "ord-1", Total: 10}, {ID: "ord-2", Total: -1}} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("expected %+v, got %+v", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("order %s was not delivered", want.ID)
+		}
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, errRejected) {
+			t.Fatalf("expected the handler error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnError was not called")
+	}
+}
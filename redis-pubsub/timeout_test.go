@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscriber_HandlerTimeout(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dlq := NewDeadLetterQueue(rdb, "product:dlq", 10)
+	cancelled := make(chan error, 1)
+	received := make(chan ProductMessage, 1)
+	errs := make(chan error, 1)
+
+	sub := NewSubscriber[ProductMessage](rdb, "product")
+	sub.HandlerTimeout = 50 * time.Millisecond
+	sub.DeadLetters = dlq
+	sub.OnError = func(ctx context.Context, err error) { errs <- err }
+	sub.OnMessage = func(ctx context.Context, data ProductMessage) error {
+		if data.Product.ID == 1 {
+			// hang until the timeout cancels the handler
+			<-ctx.Done()
+			cancelled <- ctx.Err()
+			return ctx.Err()
+		}
+		received <- data
+		return nil
+	}
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "product")
+
+	for _, id := range []int{1, 2} {
+		payload, err := NewProductMessage(NewProduct(id, "Laptop"), "create").ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rdb.Publish(ctx, "product", payload).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected handler context to hit its deadline, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("hung handler was not cancelled")
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a timeout error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out handler was not treated as failed")
+	}
+
+	select {
+	case data := <-received:
+		if data.Product.ID != 2 {
+			t.Fatalf("expected product 2, got %d", data.Product.ID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("next message was not processed after the timeout")
+	}
+
+	deadLetters, err := dlq.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("expected the timed out message to be dead-lettered, got %d dead letters", len(deadLetters))
+	}
+}
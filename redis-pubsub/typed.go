@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type typedRoute struct {
+	typ     reflect.Type
+	handler func(ctx context.Context, data any) error
+}
+
+// TypedSubscriber listens to several topics and decodes the payload of each topic
+// into the Go type registered for it, before passing it to that topic's handler.
+type TypedSubscriber struct {
+	Redis  redis.UniversalClient
+	routes map[string]typedRoute
+}
+
+func NewTypedSubscriber(rdb redis.UniversalClient) *TypedSubscriber {
+	return &TypedSubscriber{
+		Redis:  rdb,
+		routes: make(map[string]typedRoute),
+	}
+}
+
+// RegisterType decodes payloads published on topic into a new value of typ. The handler
+// receives the decoded value, not a pointer to it, unless typ itself is a pointer type.
+func (s *TypedSubscriber) RegisterType(topic string, typ reflect.Type, handler func(ctx context.Context, data any) error) {
+	s.routes[topic] = typedRoute{typ: typ, handler: handler}
+}
+
+// Register is the type safe form of RegisterType.
+func Register[T any](s *TypedSubscriber, topic string, handler func(ctx context.Context, data T) error) {
+	s.RegisterType(topic, reflect.TypeFor[T](), func(ctx context.Context, data any) error {
+		return handler(ctx, data.(T))
+	})
+}
+
+// Listen subscribes to every registered topic and processes messages until ctx is cancelled.
+func (s *TypedSubscriber) Listen(ctx context.Context) {
+	topics := make([]string, 0, len(s.routes))
+	for topic := range s.routes {
+		topics = append(topics, topic)
+	}
+
+	fmt.Println("Listening for messages on", topics)
+	pubSub := s.Redis.Subscribe(ctx, topics...)
+	defer pubSub.Close()
+
+	ch := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Subscriber shutting down...")
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				fmt.Println("Channel closed")
+				return
+			}
+			if err := s.dispatch(ctx, msg.Channel, []byte(msg.Payload)); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+func (s *TypedSubscriber) dispatch(ctx context.Context, topic string, payload []byte) error {
+	route, ok := s.routes[topic]
+	if !ok {
+		return fmt.Errorf("no type registered for topic %s", topic)
+	}
+
+	ptr := reflect.New(route.typ)
+	if err := unmarshalMessage(payload, ptr.Interface()); err != nil {
+		return fmt.Errorf("failed to unmarshal message on %s: %w", topic, err)
+	}
+
+	if err := route.handler(ctx, ptr.Elem().Interface()); err != nil {
+		return fmt.Errorf("failed to handle message on %s: %w", topic, err)
+	}
+	return nil
+}
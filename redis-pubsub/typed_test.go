@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testOrder struct {
+	ID    string  `json:"id"`
+	Total float64 `json:"total"`
+}
+
+func TestTypedSubscriber_DecodesPerTopicType(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	products := make(chan Product, 1)
+	orders := make(chan any, 1)
+
+	sub := NewTypedSubscriber(rdb)
+	Register(sub, "product", func(ctx context.Context, data Product) error {
+		products <- data
+		return nil
+	})
+	sub.RegisterType("order", reflect.TypeOf(testOrder{}), func(ctx context.Context, data any) error {
+		orders <- data
+		return nil
+	})
+	go sub.Listen(ctx)
+	waitForSubscriber(t, mr, "product")
+	waitForSubscriber(t, mr, "order")
+
+	if err := rdb.Publish(ctx, "product", `{"id":1,"name":"Laptop"}`).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.Publish(ctx, "order", `{"id":"ord-1","total":99.5}`).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case product := <-products:
+		if product != (Product{ID: 1, Name: "Laptop"}) {
+			t.Fatalf("unexpected product %+v", product)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("product was not delivered")
+	}
+
+	select {
+	case data := <-orders:
+		order, ok := data.(testOrder)
+		if !ok {
+			t.Fatalf("expected testOrder, got %T", data)
+		}
+		if order != (testOrder{ID: "ord-1", Total: 99.5}) {
+			t.Fatalf("unexpected order %+v", order)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("order was not delivered")
+	}
+}
+
+func TestTypedSubscriber_UnregisteredTopic(t *testing.T) {
+	sub := NewTypedSubscriber(nil)
+
+	if err := sub.dispatch(context.Background(), "unknown", []byte(`{}`)); err == nil {
+		t.Fatal("expected an error for a topic without a registered type")
+	}
+}
@@ -0,0 +1,119 @@
+// Package cache provides a Redis backed cache of typed values, with concurrent lookups
+// of the same key deduplicated through singleflight.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/azka-zaydan/article-materials/keys"
+	"github.com/redis/go-redis/v9"
+	s "golang.org/x/sync/singleflight"
+)
+
+// ErrMiss is returned by Get when the key is not cached.
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores values of type T as JSON in Redis. Concurrent lookups of the same key
+// share a single Redis read, and a single load on a miss.
+type Cache[T any] struct {
+	Redis redis.UniversalClient
+	Group *s.Group
+	// TTL is how long stored values are kept, 0 keeps them until they are deleted.
+	TTL time.Duration
+	// ResultTTL shares a resolved lookup with the callers arriving up to ResultTTL after it,
+	// without reading Redis again. 0 only shares lookups that are still in flight.
+	ResultTTL time.Duration
+	// Shards lets up to Shards lookups of the same key run concurrently, see Singleflight.Shards.
+	Shards int
+
+	results *Results
+}
+
+func New[T any](rdb redis.UniversalClient, ttl time.Duration) *Cache[T] {
+	return &Cache[T]{
+		Redis:   rdb,
+		Group:   &s.Group{},
+		TTL:     ttl,
+		results: &Results{},
+	}
+}
+
+// Get returns the value stored at key, or ErrMiss if there is none.
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	return c.do(keys.SingleflightKey(key), func() (T, error) {
+		return c.get(ctx, key)
+	})
+}
+
+// GetOrLoad returns the value stored at key. On a miss it calls load and stores the loaded
+// value for TTL, errors from load are returned and nothing is stored. A failure to store the
+// loaded value is not reported, the next lookup loads it again.
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	// a separate group key, so a GetOrLoad never joins a Get that would return ErrMiss
+	return c.do(keys.SingleflightLoadKey(key), func() (T, error) {
+		v, err := c.get(ctx, key)
+		if !errors.Is(err, ErrMiss) {
+			return v, err
+		}
+
+		v, err = load(ctx)
+		if err != nil {
+			return v, fmt.Errorf("failed to load %s: %w", key, err)
+		}
+		c.Set(ctx, key, v)
+		return v, nil
+	})
+}
+
+// Set stores v at key for TTL.
+func (c *Cache[T]) Set(ctx context.Context, key string, v T) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	if err := c.Redis.Set(ctx, key, data, c.TTL).Err(); err != nil {
+		return fmt.Errorf("failed to set %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes key, so the next lookup misses.
+func (c *Cache[T]) Delete(ctx context.Context, key string) error {
+	if err := c.Redis.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (c *Cache[T]) get(ctx context.Context, key string) (T, error) {
+	var v T
+	data, err := c.Redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return v, ErrMiss
+	}
+	if err != nil {
+		return v, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("failed to unmarshal %s: %w", key, err)
+	}
+	return v, nil
+}
+
+func (c *Cache[T]) do(groupKey string, fn func() (T, error)) (T, error) {
+	single := &Singleflight[T]{
+		Group:   c.Group,
+		Key:     groupKey,
+		Results: c.results,
+		Shards:  c.Shards,
+	}
+	if c.ResultTTL > 0 {
+		return single.ProcessWithTTL(fn, c.ResultTTL)
+	}
+	return single.ProccesWrapper(fn)
+}
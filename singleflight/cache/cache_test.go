@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	s "golang.org/x/sync/singleflight"
+)
+
+type product struct {
+	ID   int
+	Name string
+}
+
+func newTestCache(t *testing.T, ttl time.Duration) (*miniredis.Miniredis, *Cache[*product]) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, New[*product](rdb, ttl)
+}
+
+func TestCache_ConcurrentLoadsAreDeduplicated(t *testing.T) {
+	_, c := newTestCache(t, time.Minute)
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*product, error) {
+		loads.Add(1)
+		<-release
+		return &product{ID: 1, Name: "Laptop"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := c.GetOrLoad(ctx, "product:1", load)
+			if err != nil || p.Name != "Laptop" {
+				t.Errorf("unexpected result %+v, %v", p, err)
+			}
+		}()
+	}
+	// give every caller time to join the in-flight load
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := loads.Load(); got != 1 {
+		t.Fatalf("expected a single load, got %d", got)
+	}
+}
+
+func TestCache_MissThenLoad(t *testing.T) {
+	mr, c := newTestCache(t, time.Minute)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "product:1"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("expected ErrMiss, got %v", err)
+	}
+
+	var loads int
+	load := func(ctx context.Context) (*product, error) {
+		loads++
+		return &product{ID: 1, Name: "Laptop"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		p, err := c.GetOrLoad(ctx, "product:1", load)
+		if err != nil || p.Name != "Laptop" {
+			t.Fatalf("unexpected result %+v, %v", p, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected the second lookup to hit the cache, got %d loads", loads)
+	}
+	if !mr.Exists("product:1") {
+		t.Fatal("expected the loaded value to be stored")
+	}
+
+	p, err := c.Get(ctx, "product:1")
+	if err != nil || p.ID != 1 {
+		t.Fatalf("unexpected result %+v, %v", p, err)
+	}
+}
+
+func TestCache_LoadErrorIsNotStored(t *testing.T) {
+	mr, c := newTestCache(t, time.Minute)
+	errDB := errors.New("database unavailable")
+
+	_, err := c.GetOrLoad(context.Background(), "product:1", func(ctx context.Context) (*product, error) {
+		return nil, errDB
+	})
+	if !errors.Is(err, errDB) {
+		t.Fatalf("expected the load error, got %v", err)
+	}
+	if mr.Exists("product:1") {
+		t.Fatal("expected nothing to be stored")
+	}
+}
+
+func TestCache_TTLExpiry(t *testing.T) {
+	mr, c := newTestCache(t, time.Minute)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "product:1", &product{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("product:1"); ttl != time.Minute {
+		t.Fatalf("expected a ttl of 1m, got %v", ttl)
+	}
+
+	mr.FastForward(time.Minute)
+	if _, err := c.Get(ctx, "product:1"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("expected ErrMiss once the ttl passed, got %v", err)
+	}
+}
+
+func TestCache_TypeAssertionSafety(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+
+	// two caches of different types wrongly sharing a group and a key
+	group := &s.Group{}
+	ints := &Cache[int]{Redis: rdb, Group: group}
+	strs := &Cache[string]{Redis: rdb, Group: group}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := ints.GetOrLoad(ctx, "shared", func(ctx context.Context) (int, error) {
+			close(started)
+			<-release
+			return 42, nil
+		})
+		done <- err
+	}()
+	<-started
+
+	go func() {
+		_, err := strs.GetOrLoad(ctx, "shared", func(ctx context.Context) (string, error) {
+			return "never called", nil
+		})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	var failed int
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			failed++
+		}
+	}
+	// the string cache gets the int result and reports it instead of panicking
+	if failed != 1 {
+		t.Fatalf("expected exactly the mismatched lookup to fail, got %d failures", failed)
+	}
+}
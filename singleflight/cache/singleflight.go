@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	s "golang.org/x/sync/singleflight"
+)
+
+// Singleflight deduplicates concurrent calls sharing Key within Group and returns their
+// result as T.
+type Singleflight[T any] struct {
+	Group *s.Group
+	Key   string
+	// InFlight tracks running calls so shutdown can drain them, it is optional and
+	// should be shared by every instance using the same Group.
+	InFlight *InFlight
+	// Results keeps the results resolved by ProcessWithTTL and should be shared by every
+	// instance using the same Group. ProcessWithTTL allocates one for this instance alone
+	// when it is nil.
+	Results     *Results
+	resultsOnce sync.Once
+	// ForgetOnError forgets the key as soon as a call fails, so only the callers already
+	// waiting share the error and the next caller retries, instead of the error being
+	// shared for the rest of the call or the TTL of ProcessWithTTL.
+	ForgetOnError bool
+	// Active tracks the keys with a call in flight, for Keys and ForgetAll. It is optional
+	// and should be shared by every instance using the same Group.
+	Active *ActiveKeys
+	// Shards spreads the calls for Key over this many sub-keys, each caller joining a random
+	// one, so up to Shards calls for the same Key run concurrently. It trades deduplication
+	// for parallelism on very expensive calls. 0 or 1 runs a single call.
+	Shards int
+}
+
+// groupKey returns the key the call is deduplicated on: Key, or a random shard of it.
+func (single *Singleflight[T]) groupKey() string {
+	if single.Shards <= 1 {
+		return single.Key
+	}
+	return shardKey(single.Key, rand.IntN(single.Shards))
+}
+
+// groupKeys returns every key the calls for key may be deduplicated on.
+func (single *Singleflight[T]) groupKeys(key string) []string {
+	if single.Shards <= 1 {
+		return []string{key}
+	}
+	keys := make([]string, single.Shards)
+	for i := range keys {
+		keys[i] = shardKey(key, i)
+	}
+	return keys
+}
+
+func shardKey(key string, shard int) string {
+	return key + ":shard:" + strconv.Itoa(shard)
+}
+
+// Results holds resolved results until their TTL expires.
+type Results struct {
+	mu sync.Mutex
+	m  map[string]*result
+}
+
+type result struct {
+	val any
+	err error
+}
+
+func (r *Results) get(key string) (*result, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, ok := r.m[key]
+	return res, ok
+}
+
+func (r *Results) set(key string, res *result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.m == nil {
+		r.m = make(map[string]*result)
+	}
+	r.m[key] = res
+}
+
+// delete removes res and reports whether it did, it does not when key has been resolved
+// again since.
+func (r *Results) delete(key string, res *result) (deleted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.m[key] != res {
+		return false
+	}
+	delete(r.m, key)
+	return true
+}
+
+// ActiveKeys is the set of group keys with a call in flight, which s.Group does not expose.
+type ActiveKeys struct {
+	mu sync.Mutex
+	// m holds the token of the call running for each key, so a call that was forgotten
+	// does not remove the call that replaced it when it completes
+	m    map[string]uint64
+	next uint64
+}
+
+func (a *ActiveKeys) add(key string) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.m == nil {
+		a.m = make(map[string]uint64)
+	}
+	a.next++
+	a.m[key] = a.next
+	return a.next
+}
+
+// remove removes key, unless the call started with token was replaced since.
+func (a *ActiveKeys) remove(key string, token uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.m[key] == token {
+		delete(a.m, key)
+	}
+}
+
+func (a *ActiveKeys) forget(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.m, key)
+}
+
+// Keys returns the keys with a call in flight, sorted.
+func (a *ActiveKeys) Keys() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Sorted(maps.Keys(a.m))
+}
+
+// clear removes every key and returns them.
+func (a *ActiveKeys) clear() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keys := slices.Collect(maps.Keys(a.m))
+	clear(a.m)
+	return keys
+}
+
+// InFlight counts the calls currently running through the Singleflight instances sharing it.
+type InFlight struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func (f *InFlight) add() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n == 0 {
+		f.idle = make(chan struct{})
+	}
+	f.n++
+}
+
+func (f *InFlight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 {
+		close(f.idle)
+	}
+}
+
+// Wait blocks until no call is in flight or ctx is done, in which case it returns ctx.Err().
+func (f *InFlight) Wait(ctx context.Context) error {
+	f.mu.Lock()
+	if f.n == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	idle := f.idle
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until every in-flight call tracked by InFlight completes or ctx is done.
+func (single *Singleflight[T]) Wait(ctx context.Context) error {
+	if single.InFlight == nil {
+		return nil
+	}
+	return single.InFlight.Wait(ctx)
+}
+
+func (single *Singleflight[T]) ProccesWrapper(fn func() (T, error)) (T, error) {
+	res, _, err := single.ProcessWrapperShared(fn)
+	return res, err
+}
+
+// ProcessWrapperShared is ProccesWrapper, also reporting whether the result was shared
+// with other callers, which tells how many calls the deduplication saved.
+func (single *Singleflight[T]) ProcessWrapperShared(fn func() (T, error)) (T, bool, error) {
+	if single.InFlight != nil {
+		single.InFlight.add()
+		defer single.InFlight.done()
+	}
+
+	key := single.groupKey()
+	res, err, shared := single.Group.Do(key, single.wrap(key, fn))
+	result, err := assertResult[T](res, err)
+	return result, shared, err
+}
+
+// ProcessWrapperCtx is ProccesWrapper, except it returns ctx.Err() as soon as ctx is done.
+// The call itself keeps running for the other callers sharing it, and InFlight tracks it
+// until it completes.
+func (single *Singleflight[T]) ProcessWrapperCtx(ctx context.Context, fn func() (T, error)) (T, error) {
+	if single.InFlight != nil {
+		single.InFlight.add()
+	}
+
+	key := single.groupKey()
+	ch := single.Group.DoChan(key, single.wrap(key, fn))
+	select {
+	case res := <-ch:
+		if single.InFlight != nil {
+			single.InFlight.done()
+		}
+		return assertResult[T](res.Val, res.Err)
+	case <-ctx.Done():
+		if single.InFlight != nil {
+			go func() {
+				<-ch
+				single.InFlight.done()
+			}()
+		}
+		return *new(T), ctx.Err()
+	}
+}
+
+// wrap adapts fn to the Group, tracking key in Active and forgetting it when fn fails and
+// ForgetOnError is set.
+func (single *Singleflight[T]) wrap(key string, fn func() (T, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		if single.Active != nil {
+			token := single.Active.add(key)
+			defer single.Active.remove(key, token)
+		}
+
+		res, err := fn()
+		if err != nil && single.ForgetOnError {
+			single.Group.Forget(key)
+		}
+		return res, err
+	}
+}
+
+func assertResult[T any](res any, err error) (T, error) {
+	// Type assertion check
+	if result, ok := res.(T); ok {
+		return result, err
+	}
+
+	// Handle type assertion failure gracefully
+	err = errors.New("unexpected type assertion failure")
+	return *new(T), err
+}
+
+// ProcessWithTTL is ProccesWrapper, except the result, error included, is shared with the
+// callers arriving up to ttl after the call resolved, and the key is forgotten once ttl has
+// passed, so an errored result is retried after at most ttl. The result is kept in Results,
+// which is allocated on the first call when it is nil.
+func (single *Singleflight[T]) ProcessWithTTL(fn func() (T, error), ttl time.Duration) (T, error) {
+	if res, ok := single.resolved(); ok {
+		return assertResult[T](res.val, res.err)
+	}
+
+	return single.ProccesWrapper(func() (T, error) {
+		// a caller that missed the result above may become the next leader right after it was stored
+		if res, ok := single.resolved(); ok {
+			return assertResult[T](res.val, res.err)
+		}
+
+		val, err := fn()
+		if err != nil && single.ForgetOnError {
+			return val, err
+		}
+		single.remember(&result{val: val, err: err}, ttl)
+		return val, err
+	})
+}
+
+// results returns Results, allocating it on first use when it is nil.
+func (single *Singleflight[T]) results() *Results {
+	single.resultsOnce.Do(func() {
+		if single.Results == nil {
+			single.Results = &Results{}
+		}
+	})
+	return single.Results
+}
+
+func (single *Singleflight[T]) resolved() (*result, bool) {
+	return single.results().get(single.Key)
+}
+
+// remember keeps res in Results for ttl and then forgets the key.
+func (single *Singleflight[T]) remember(res *result, ttl time.Duration) {
+	group, key, results := single.Group, single.Key, single.results()
+	results.set(key, res)
+
+	groupKeys := single.groupKeys(key)
+	time.AfterFunc(ttl, func() {
+		// a newer result owns the key now, forgetting it would split the calls sharing it
+		if !results.delete(key, res) {
+			return
+		}
+		for _, groupKey := range groupKeys {
+			group.Forget(groupKey)
+		}
+	})
+}
+
+// Forget forgets keys, and all their shards when Shards is set.
+func (single *Singleflight[T]) Forget(keys ...string) {
+	for _, key := range keys {
+		for _, groupKey := range single.groupKeys(key) {
+			single.Group.Forget(groupKey)
+			if single.Active != nil {
+				single.Active.forget(groupKey)
+			}
+		}
+	}
+}
+
+// Keys returns the group keys with a call in flight, shard keys included, as tracked by
+// Active. It is empty without Active.
+func (single *Singleflight[T]) Keys() []string {
+	if single.Active == nil {
+		return nil
+	}
+	return single.Active.Keys()
+}
+
+// ForgetAll forgets every key with a call in flight, so the next call of each key runs
+// again instead of joining it. It needs Active, and like Forget it does not drop the
+// results kept by ProcessWithTTL.
+func (single *Singleflight[T]) ForgetAll() {
+	if single.Active == nil {
+		return
+	}
+	for _, key := range single.Active.clear() {
+		single.Group.Forget(key)
+	}
+}
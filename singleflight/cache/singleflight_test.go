@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	s "golang.org/x/sync/singleflight"
+)
+
+func TestSingleflight_ProcessWrapperShared(t *testing.T) {
+	single := Singleflight[*product]{
+		Group: &s.Group{},
+		Key:   "singleflight:product:1",
+	}
+
+	const callers = 20
+	var calls, sharedCount atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (*product, error) {
+		calls.Add(1)
+		<-release
+		return &product{ID: 1}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, shared, err := single.ProcessWrapperShared(fetch); err == nil && shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	// give every caller time to join the in-flight call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected a single call, got %d", got)
+	}
+	if got := sharedCount.Load(); got != callers {
+		t.Fatalf("expected every caller to report a shared result, got %d of %d", got, callers)
+	}
+
+	// a lone caller does not share its result
+	if _, shared, _ := single.ProcessWrapperShared(func() (*product, error) { return &product{}, nil }); shared {
+		t.Fatal("expected a lone call not to be shared")
+	}
+}
+
+func BenchmarkSingleflight_ProcessWrapperShared(b *testing.B) {
+	single := Singleflight[*product]{
+		Group: &s.Group{},
+		Key:   "singleflight:product:1",
+	}
+	fetch := func() (*product, error) {
+		time.Sleep(time.Millisecond)
+		return &product{ID: 1}, nil
+	}
+
+	var shared atomic.Int64
+	// run several callers per CPU so the fetches overlap
+	b.SetParallelism(10)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, ok, _ := single.ProcessWrapperShared(fetch); ok {
+				shared.Add(1)
+			}
+		}
+	})
+	b.ReportMetric(float64(shared.Load())/float64(b.N), "shared/op")
+}
+
+func TestSingleflight_ProcessWrapperCtx(t *testing.T) {
+	single := Singleflight[*product]{
+		Group:    &s.Group{},
+		Key:      "singleflight:product:1",
+		InFlight: &InFlight{},
+	}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (*product, error) {
+		calls.Add(1)
+		<-release
+		return &product{ID: 1}, nil
+	}
+
+	// the caller whose context fires gives up without waiting for the call
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := single.ProcessWrapperCtx(ctx, fetch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// the call is still running, so a later caller shares it rather than starting another
+	done := make(chan *product)
+	go func() {
+		res, err := single.ProcessWrapperCtx(context.Background(), fetch)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		done <- res
+	}()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer waitCancel()
+	if err := single.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the abandoned call to still be in flight, got %v", err)
+	}
+
+	close(release)
+	if res := <-done; res == nil || res.ID != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected a single call, got %d", got)
+	}
+	if err := single.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error waiting for in-flight calls: %v", err)
+	}
+}
+
+func TestSingleflight_Shards(t *testing.T) {
+	single := Singleflight[*product]{
+		Group:  &s.Group{},
+		Key:    "singleflight:product:1",
+		Shards: 2,
+	}
+
+	var running, maxRunning, calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (*product, error) {
+		calls.Add(1)
+		n := running.Add(1)
+		for {
+			current := maxRunning.Load()
+			if n <= current || maxRunning.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		return &product{ID: 1}, nil
+	}
+
+	// with 20 callers picking one of 2 shards at random, both shards are all but certain to be used
+	const callers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := single.ProccesWrapper(fetch); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := maxRunning.Load(); got != 2 {
+		t.Fatalf("expected 2 concurrent executions, got %d", got)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected one execution per shard, got %d", got)
+	}
+}
+
+func TestSingleflight_KeysAndForgetAll(t *testing.T) {
+	group, active := &s.Group{}, &ActiveKeys{}
+	products := Singleflight[*product]{Group: group, Key: "singleflight:product:1", Active: active}
+	users := Singleflight[*product]{Group: group, Key: "singleflight:user:1", Active: active}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (*product, error) {
+		calls.Add(1)
+		<-release
+		return &product{ID: 1}, nil
+	}
+
+	var wg sync.WaitGroup
+	for _, single := range []*Singleflight[*product]{&products, &users} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := single.ProccesWrapper(fetch); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	want := []string{"singleflight:product:1", "singleflight:user:1"}
+	if got := products.Keys(); !slices.Equal(got, want) {
+		t.Fatalf("expected in-flight keys %v, got %v", want, got)
+	}
+
+	products.ForgetAll()
+	if got := products.Keys(); len(got) != 0 {
+		t.Fatalf("expected no keys after ForgetAll, got %v", got)
+	}
+
+	// both keys were forgotten, so these calls run again instead of joining the blocked ones
+	for _, single := range []*Singleflight[*product]{&products, &users} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := single.ProccesWrapper(fetch); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := calls.Load(); got != 4 {
+		t.Fatalf("expected the calls after ForgetAll to run again, got %d executions", got)
+	}
+	if got := products.Keys(); !slices.Equal(got, want) {
+		t.Fatalf("expected the new calls to be tracked, got %v", got)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := products.Keys(); len(got) != 0 {
+		t.Fatalf("expected no keys once the calls completed, got %v", got)
+	}
+}
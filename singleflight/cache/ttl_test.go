@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	s "golang.org/x/sync/singleflight"
+)
+
+func TestSingleflight_ProcessWithTTL(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	single := Singleflight[*product]{
+		Group:   &s.Group{},
+		Key:     "singleflight:product:1",
+		Results: &Results{},
+	}
+
+	var calls atomic.Int32
+	errPoisoned := errors.New("cache unavailable")
+	fetch := func() (*product, error) {
+		if calls.Add(1) == 1 {
+			time.Sleep(20 * time.Millisecond)
+			return nil, errPoisoned
+		}
+		return &product{ID: 1, Name: "Laptop"}, nil
+	}
+
+	// concurrent callers during the call and within the ttl window share the errored result
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := single.ProcessWithTTL(fetch, ttl); !errors.Is(err, errPoisoned) {
+				t.Errorf("expected the shared error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := single.ProcessWithTTL(fetch, ttl); !errors.Is(err, errPoisoned) {
+		t.Fatalf("expected the result to be shared within the ttl, got %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected a single call within the ttl, got %d", got)
+	}
+
+	// once the ttl passed the key is forgotten and the call is made again
+	time.Sleep(ttl + 50*time.Millisecond)
+
+	product, err := single.ProcessWithTTL(fetch, ttl)
+	if err != nil {
+		t.Fatalf("expected the retried call to succeed, got %v", err)
+	}
+	if product.Name != "Laptop" {
+		t.Fatalf("unexpected product: %+v", product)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected a second call after the ttl, got %d", got)
+	}
+}
+
+func TestSingleflight_ProcessWithTTL_WithoutResults(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	single := Singleflight[*product]{
+		Group: &s.Group{},
+		Key:   "singleflight:product:1",
+	}
+
+	var calls atomic.Int32
+	fetch := func() (*product, error) {
+		calls.Add(1)
+		return &product{ID: 1, Name: "Laptop"}, nil
+	}
+
+	// without Results one is allocated, so the ttl is still honoured
+	for i := 0; i < 3; i++ {
+		if _, err := single.ProcessWithTTL(fetch, ttl); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if single.Results == nil {
+		t.Fatal("expected Results to be allocated")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected the result to be shared within the ttl, got %d calls", got)
+	}
+
+	time.Sleep(ttl + 30*time.Millisecond)
+	if _, err := single.ProcessWithTTL(fetch, ttl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected a second call after the ttl, got %d", got)
+	}
+}
+
+func TestSingleflight_ForgetOnError(t *testing.T) {
+	const ttl = time.Minute
+	single := Singleflight[*product]{
+		Group:         &s.Group{},
+		Key:           "singleflight:product:1",
+		Results:       &Results{},
+		ForgetOnError: true,
+	}
+
+	var calls atomic.Int32
+	errTransient := errors.New("connection reset")
+	fetch := func() (*product, error) {
+		time.Sleep(20 * time.Millisecond)
+		if calls.Add(1) == 1 {
+			return nil, errTransient
+		}
+		return &product{ID: 1, Name: "Laptop"}, nil
+	}
+
+	wave := func() (failed int) {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := single.ProcessWithTTL(fetch, ttl); err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		return failed
+	}
+
+	if failed := wave(); failed == 0 {
+		t.Fatal("expected the first wave to see the transient error")
+	}
+	// without ForgetOnError the error would be shared for the whole ttl
+	if failed := wave(); failed != 0 {
+		t.Fatalf("expected the second wave to succeed, %d calls failed", failed)
+	}
+}
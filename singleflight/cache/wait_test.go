@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	s "golang.org/x/sync/singleflight"
+)
+
+func TestSingleflight_WaitDrainsInFlightCalls(t *testing.T) {
+	const slow = 200 * time.Millisecond
+	started := make(chan struct{})
+
+	single := Singleflight[*product]{
+		Group:    &s.Group{},
+		Key:      "singleflight:product:1",
+		InFlight: &InFlight{},
+	}
+
+	go single.ProccesWrapper(func() (*product, error) {
+		close(started)
+		time.Sleep(slow)
+		return &product{ID: 1}, nil
+	})
+	<-started
+
+	t.Run("deadline shorter than the call", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if err := single.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("returns once the call completes", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if err := single.Wait(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := single.Wait(ctx); err != nil {
+			t.Fatalf("waiting with nothing in flight should return right away, got %v", err)
+		}
+	})
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/azka-zaydan/article-materials/keys"
+	"github.com/azka-zaydan/article-materials/singleflight/cache"
 	"github.com/pkg/errors"
 
 	"github.com/redis/go-redis/v9"
@@ -18,69 +19,36 @@ type Product struct {
 	Name string
 }
 
-type Singleflight[T any] struct {
-	Group *s.Group
-	Key   string
-}
-
-func (single *Singleflight[T]) ProccesWrapper(fn func() (T, error)) (T, error) {
-	wrapperFn := func() (interface{}, error) {
-		return fn()
-	}
-
-	res, err, _ := single.Group.Do(single.Key, wrapperFn)
-
-	// Type assertion check
-	if result, ok := res.(T); ok {
-		return result, err
-	}
-
-	// Handle type assertion failure gracefully
-	err = errors.New("unexpected type assertion failure")
-	return *new(T), err
-}
+// productResultTTL is how long a product lookup is shared with later callers.
+const productResultTTL = time.Second
 
-func (single *Singleflight[T]) Forget(keys ...string) {
-	for _, key := range keys {
-		single.Group.Forget(key)
+func getProductFromCache(productCache *cache.Cache[*Product], productID int) (*Product, error) {
+	// get the product from cache, requests within productResultTTL share the lookup
+	res, err := productCache.Get(context.Background(), keys.ProductKey(productID))
+	if err != nil {
+		if errors.Is(err, cache.ErrMiss) {
+			return nil, nil
+		}
+		err = errors.Wrap(err, "Failed to get product from cache")
+		return nil, err
 	}
+	return res, nil
 }
 
-func getProductFromCache(rdb *redis.Client, sGroup *s.Group, productID int, currIdx int) (*Product, error) {
-
-	singleflightInstance := Singleflight[*Product]{
+// getProductCached is the cache-aside lookup of a product: on a miss it calls loader, e.g. a
+// database query, and stores the product in Redis for ttl. Concurrent lookups of the same
+// product share the Redis read and the load through sGroup, so only one of them loads it.
+func getProductCached(ctx context.Context, rdb redis.UniversalClient, sGroup *s.Group, productID int, loader func() (*Product, error), ttl time.Duration) (*Product, error) {
+	productCache := &cache.Cache[*Product]{
+		Redis: rdb,
 		Group: sGroup,
-		Key:   fmt.Sprintf("singleflight:product:%v", productID),
+		TTL:   ttl,
 	}
-
-	if currIdx == 2 {
-		singleflightInstance.Forget(fmt.Sprintf("singleflight:product:%v", productID))
-	}
-
-	// get the product from cache
-	res, err := singleflightInstance.ProccesWrapper(func() (*Product, error) {
-		val, err := rdb.Get(context.Background(), fmt.Sprintf("product:%v", productID)).Result()
-		if err != nil {
-			if errors.Is(err, redis.Nil) {
-				return nil, nil
-			}
-			msg := fmt.Sprintf("Error: %v", err)
-			fmt.Println(msg)
-			return nil, err
-		}
-
-		// unmarshal the value
-		var product Product
-		if err := json.Unmarshal([]byte(val), &product); err != nil {
-			err = errors.Wrap(err, "Failed to unmarshal product")
-			return nil, err
-		}
-		return &product, nil
+	res, err := productCache.GetOrLoad(ctx, keys.ProductKey(productID), func(context.Context) (*Product, error) {
+		return loader()
 	})
-
 	if err != nil {
-		err = errors.Wrap(err, "Failed to get product from cache")
-		return nil, err
+		return nil, errors.Wrap(err, "Failed to get product")
 	}
 	return res, nil
 }
@@ -98,18 +66,11 @@ func main() {
 		ID:   1,
 		Name: "Product 1",
 	}
-	sGroup := s.Group{}
-
-	// marshal the product instance
-	productBytes, err := json.Marshal(product)
-	if err != nil {
-		msg := fmt.Sprintln("Failed to marshal product")
-		fmt.Println(msg)
-		return
-	}
+	productCache := cache.New[*Product](rdb, 0)
+	productCache.ResultTTL = productResultTTL
 
 	// set the product instance to redis
-	err = rdb.Set(context.Background(), fmt.Sprintf("product:%v", product.ID), productBytes, 0).Err()
+	err := productCache.Set(context.Background(), keys.ProductKey(product.ID), &product)
 	if err != nil {
 		msg := fmt.Sprintf("Failed to set product to cache %v", err)
 		fmt.Println(msg)
@@ -123,13 +84,13 @@ func main() {
 		wg.Add(1)
 		idxPtr := &i
 		go func(idx *int) {
-			// if idx is 2, wait for 5 seconds
+			// if idx is 2, wait for 5 seconds, past productResultTTL, so it looks the product up again
 			if *idx == 2 {
 				fmt.Println("Sleeping for 5 seconds")
 				time.Sleep(5 * time.Second)
 			}
 			defer wg.Done()
-			_, err := getProductFromCache(rdb, &sGroup, product.ID, *idx)
+			_, err := getProductFromCache(productCache, product.ID)
 			if err != nil {
 				msg := fmt.Sprintf("Error: %v", err)
 				fmt.Println(msg)
@@ -139,4 +100,21 @@ func main() {
 	}
 
 	wg.Wait()
+
+	// cache-aside: a product that is not cached yet is loaded once and written to Redis
+	var sGroup s.Group
+	loadProduct := func() (*Product, error) {
+		fmt.Println("Loading product 2 from the database")
+		return &Product{ID: 2, Name: "Product 2"}, nil
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := getProductCached(context.Background(), rdb, &sGroup, 2, loadProduct, time.Minute); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		}()
+	}
+	wg.Wait()
 }
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/azka-zaydan/article-materials/keys"
+	"github.com/azka-zaydan/article-materials/singleflight/cache"
+	"github.com/redis/go-redis/v9"
 	s "golang.org/x/sync/singleflight"
 )
 
@@ -21,9 +28,9 @@ func getProductWithoutSingleflight() (*Product, error) {
 
 // Function using singleflight to fetch product
 func getProductWithSingleflight(sGroup *s.Group) (*Product, error) {
-	singleflightInstance := Singleflight[*Product]{
+	singleflightInstance := cache.Singleflight[*Product]{
 		Group: sGroup,
-		Key:   "singleflight:product:1",
+		Key:   keys.SingleflightProductKey(1),
 	}
 
 	return singleflightInstance.ProccesWrapper(fetchProduct)
@@ -56,3 +63,69 @@ func BenchmarkWithSingleflight(b *testing.B) {
 	}
 	wg.Wait()
 }
+
+func TestGetProductCached_WritesThroughOnMiss(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+	var sGroup s.Group
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := func() (*Product, error) {
+		loads.Add(1)
+		<-release
+		return &Product{ID: 1, Name: "Laptop"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := getProductCached(ctx, rdb, &sGroup, 1, loader, time.Minute)
+			if err != nil || res == nil || res.Name != "Laptop" {
+				t.Errorf("unexpected result %+v, %v", res, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := loads.Load(); got != 1 {
+		t.Fatalf("expected a single load, got %d", got)
+	}
+	if !mr.Exists(keys.ProductKey(1)) {
+		t.Fatal("expected the loaded product to be written to Redis")
+	}
+	if ttl := mr.TTL(keys.ProductKey(1)); ttl != time.Minute {
+		t.Fatalf("expected a 1m TTL, got %v", ttl)
+	}
+
+	// the next lookup is served from Redis
+	if _, err := getProductCached(ctx, rdb, &sGroup, 1, loader, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := loads.Load(); got != 1 {
+		t.Fatalf("expected the cached product to be used, got %d loads", got)
+	}
+}
+
+func TestGetProductCached_LoaderError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	errDB := errors.New("db down")
+
+	_, err := getProductCached(context.Background(), rdb, &s.Group{}, 1, func() (*Product, error) {
+		return nil, errDB
+	}, time.Minute)
+	if !errors.Is(err, errDB) {
+		t.Fatalf("expected the loader error, got %v", err)
+	}
+	if mr.Exists(keys.ProductKey(1)) {
+		t.Fatal("expected nothing to be cached after a failed load")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TxOp is a single write executed as part of a batched transaction.
+type TxOp func(ctx context.Context, tx *sqlx.Tx) error
+
+// BatchError is returned when a batch fails. The whole batch is rolled back,
+// so every op in RolledBack has to be retried, not only the one that failed.
+type BatchError struct {
+	FailedID   uint64
+	RolledBack []uint64
+	Err        error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch rolled back (%d ops) because op %d failed: %v", len(e.RolledBack), e.FailedID, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+type batchedOp struct {
+	id uint64
+	op TxOp
+}
+
+// BatchCommitter groups independent writes into a single transaction to amortize
+// the commit overhead. A batch is flushed once it holds MaxSize ops or MaxWait after
+// its first op was added, whichever comes first.
+type BatchCommitter struct {
+	DB      *sqlx.DB
+	MaxSize int
+	// MaxWait of 0 disables time based flushing.
+	MaxWait time.Duration
+	// OnFlush receives the result of flushes triggered by MaxWait, it is optional.
+	OnFlush func(err error)
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending []batchedOp
+	timer   *time.Timer
+}
+
+func NewBatchCommitter(db *sqlx.DB, maxSize int, maxWait time.Duration) *BatchCommitter {
+	return &BatchCommitter{
+		DB:      db,
+		MaxSize: maxSize,
+		MaxWait: maxWait,
+	}
+}
+
+// Add queues op and returns its id. When the batch reaches MaxSize it is flushed
+// right away and the flush result is returned.
+func (b *BatchCommitter) Add(ctx context.Context, op TxOp) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	b.pending = append(b.pending, batchedOp{id: id, op: op})
+
+	if b.MaxSize > 0 && len(b.pending) >= b.MaxSize {
+		return id, b.flushLocked(ctx)
+	}
+
+	if b.timer == nil && b.MaxWait > 0 {
+		b.timer = time.AfterFunc(b.MaxWait, func() {
+			err := b.Flush(context.Background())
+			if b.OnFlush != nil {
+				b.OnFlush(err)
+			}
+		})
+	}
+	return id, nil
+}
+
+// Flush commits the pending ops in a single transaction.
+func (b *BatchCommitter) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked(ctx)
+}
+
+func (b *BatchCommitter) flushLocked(ctx context.Context) (err error) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	batch := b.pending
+	b.pending = nil
+	if len(batch) == 0 {
+		return nil
+	}
+
+	ids := make([]uint64, len(batch))
+	for i, op := range batch {
+		ids[i] = op.id
+	}
+
+	tx, err := b.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return &BatchError{RolledBack: ids, Err: fmt.Errorf("failed to begin transaction: %w", err)}
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, op := range batch {
+		if err = op.op(ctx, tx); err != nil {
+			return &BatchError{FailedID: op.id, RolledBack: ids, Err: err}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return &BatchError{RolledBack: ids, Err: fmt.Errorf("failed to commit transaction: %w", err)}
+	}
+	return nil
+}
+
+// maxBatchRows caps the rows of a single multi-row INSERT, Postgres allows at most
+// 65535 parameters per statement.
+const maxBatchRows = 1000
+
+// userRow is a User with the created_at bound by the batch inserts, like CreateUserAt.
+type userRow struct {
+	User
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type userTokenRow struct {
+	UserID    string    `db:"user_id"`
+	Token     string    `db:"token"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func newUserRows(users []User, createdAt time.Time) []userRow {
+	rows := make([]userRow, len(users))
+	for i, u := range users {
+		rows[i] = userRow{User: u, CreatedAt: createdAt}
+	}
+	return rows
+}
+
+// CreateUsersBatch inserts users and a token for each of them in a single transaction,
+// using multi-row INSERTs instead of one transaction per user. If any insert fails the
+// whole batch is rolled back.
+func CreateUsersBatch(ctx context.Context, users []User) error {
+	_, err := createUsersBatch(ctx, users, false)
+	return err
+}
+
+// CreateUsersBatchSkipConflicts is CreateUsersBatch, except a user conflicting with an existing
+// one, or with an earlier user of the batch, on its id or email is skipped instead of failing
+// the batch. The other users and their tokens are still inserted, conflicts holds the indexes
+// of the skipped users. Other errors still roll back the whole batch.
+func CreateUsersBatchSkipConflicts(ctx context.Context, users []User) (conflicts []int, err error) {
+	return createUsersBatch(ctx, users, true)
+}
+
+func createUsersBatch(ctx context.Context, users []User, skipConflicts bool) (conflicts []int, err error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// every row of the batch shares one timestamp, as CreateUser's rows get theirs from time.Now()
+	createdAt := time.Now()
+	for start := 0; start < len(users); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(users))
+
+		inserted := users[start:end]
+		if skipConflicts {
+			var skipped []int
+			if inserted, skipped, err = insertUsersSkipConflicts(ctx, tx, inserted, createdAt); err != nil {
+				return nil, err
+			}
+			for _, i := range skipped {
+				conflicts = append(conflicts, start+i)
+			}
+		} else {
+			query := "INSERT INTO users (id, name, email, created_at) VALUES (:id, :name, :email, :created_at)"
+			if _, err = tx.NamedExecContext(ctx, query, newUserRows(inserted, createdAt)); err != nil {
+				return nil, fmt.Errorf("failed to batch insert users: %w", err)
+			}
+		}
+		if len(inserted) == 0 {
+			continue
+		}
+
+		tokens := make([]userTokenRow, len(inserted))
+		for i, u := range inserted {
+			tokens[i] = userTokenRow{UserID: u.ID, Token: generateToken(u.ID), CreatedAt: createdAt}
+		}
+		query := "INSERT INTO user_tokens (user_id, token, created_at) VALUES (:user_id, :token, :created_at)"
+		if _, err = tx.NamedExecContext(ctx, query, tokens); err != nil {
+			return nil, fmt.Errorf("failed to batch insert user tokens: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return conflicts, nil
+}
+
+// insertUsersSkipConflicts inserts users with ON CONFLICT DO NOTHING, which skips the
+// conflicting rows instead of aborting the transaction, and returns the inserted users
+// and the indexes of the skipped ones.
+func insertUsersSkipConflicts(ctx context.Context, tx *sqlx.Tx, users []User, createdAt time.Time) (inserted []User, skipped []int, err error) {
+	query := "INSERT INTO users (id, name, email, created_at) VALUES (:id, :name, :email, :created_at) ON CONFLICT DO NOTHING RETURNING id"
+	rows, err := sqlx.NamedQueryContext(ctx, tx, query, newUserRows(users, createdAt))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to batch insert users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool, len(users))
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan inserted user id: %w", err)
+		}
+		ids[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to batch insert users: %w", err)
+	}
+
+	for i, u := range users {
+		// a repeated id was inserted once, by its first occurrence
+		if ids[u.ID] {
+			delete(ids, u.ID)
+			inserted = append(inserted, u)
+			continue
+		}
+		skipped = append(skipped, i)
+	}
+	return inserted, skipped, nil
+}
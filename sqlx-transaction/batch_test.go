@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func insertUserOp(name string) TxOp {
+	return func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (name) VALUES ($1)", name)
+		return err
+	}
+}
+
+func TestBatchCommitter_FlushesOnSizeBoundary(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	ctx := context.Background()
+	committer := NewBatchCommitter(sqlxDB, 2, 0)
+
+	// nothing is expected yet, sqlmock fails on any statement
+	if _, err := committer.Add(ctx, insertUserOp("Alice")); err != nil {
+		t.Fatalf("first add should only queue, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (name) VALUES ($1)")).WithArgs("Alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (name) VALUES ($1)")).WithArgs("Bob").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := committer.Add(ctx, insertUserOp("Bob")); err != nil {
+		t.Fatalf("unexpected flush error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchCommitter_FailingOpRollsBackBatch(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	ctx := context.Background()
+	committer := NewBatchCommitter(sqlxDB, 3, 0)
+
+	errDuplicate := errors.New("duplicate key value")
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").WithArgs("Alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO users").WithArgs("Bob").WillReturnError(errDuplicate)
+	mock.ExpectRollback()
+
+	firstID, _ := committer.Add(ctx, insertUserOp("Alice"))
+	secondID, _ := committer.Add(ctx, insertUserOp("Bob"))
+	thirdID, err := committer.Add(ctx, insertUserOp("Charlie"))
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected BatchError, got %v", err)
+	}
+	if !errors.Is(err, errDuplicate) {
+		t.Fatalf("expected the op error to be wrapped, got %v", err)
+	}
+	if batchErr.FailedID != secondID {
+		t.Errorf("expected op %d to be reported as failed, got %d", secondID, batchErr.FailedID)
+	}
+	if !slices.Equal(batchErr.RolledBack, []uint64{firstID, secondID, thirdID}) {
+		t.Errorf("expected every op to be reported as rolled back, got %v", batchErr.RolledBack)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchCommitter_FlushesOnTimeBoundary(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	flushed := make(chan error, 1)
+	committer := NewBatchCommitter(sqlxDB, 10, 20*time.Millisecond)
+	committer.OnFlush = func(err error) { flushed <- err }
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").WithArgs("Alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := committer.Add(context.Background(), insertUserOp("Alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatalf("unexpected flush error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("batch was not flushed after MaxWait")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func batchUsers(n int) []User {
+	users := make([]User, n)
+	for i := range users {
+		id := fmt.Sprintf("user-%d", i)
+		users[i] = User{ID: id, Name: "name-" + id, Email: id + "@example.com"}
+	}
+	return users
+}
+
+func TestCreateUsersBatch_SingleTransaction(t *testing.T) {
+	mock := useMockDB(t)
+	users := batchUsers(2)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name, email, created_at) VALUES ($1, $2, $3, $4),($5, $6, $7, $8)")).
+		WithArgs("user-0", "name-user-0", "user-0@example.com", sqlmock.AnyArg(), "user-1", "name-user-1", "user-1@example.com", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_tokens (user_id, token, created_at) VALUES ($1, $2, $3),($4, $5, $6)")).
+		WithArgs("user-0", "token-user-0", sqlmock.AnyArg(), "user-1", "token-user-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := CreateUsersBatch(context.Background(), users); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sameTime matches a time.Time argument, and every later one equal to the first it saw.
+type sameTime struct{ first *time.Time }
+
+func (m sameTime) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	if m.first.IsZero() {
+		*m.first = got
+	}
+	return got.Equal(*m.first)
+}
+
+func TestCreateUsersBatch_BindsCreatedAt(t *testing.T) {
+	mock := useMockDB(t)
+	users := batchUsers(2)
+	createdAt := sameTime{first: new(time.Time)}
+
+	// users and tokens share one bound timestamp instead of the database's NOW()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name, email, created_at) VALUES ($1, $2, $3, $4),($5, $6, $7, $8)")).
+		WithArgs("user-0", "name-user-0", "user-0@example.com", createdAt, "user-1", "name-user-1", "user-1@example.com", createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_tokens (user_id, token, created_at) VALUES ($1, $2, $3),($4, $5, $6)")).
+		WithArgs("user-0", "token-user-0", createdAt, "user-1", "token-user-1", createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := CreateUsersBatch(context.Background(), users); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateUsersBatch_FailureRollsBackBatch(t *testing.T) {
+	mock := useMockDB(t)
+	errDuplicate := errors.New("duplicate key value")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("INSERT INTO user_tokens").WillReturnError(errDuplicate)
+	mock.ExpectRollback()
+
+	err := CreateUsersBatch(context.Background(), batchUsers(3))
+	if !errors.Is(err, errDuplicate) {
+		t.Fatalf("expected %v, got %v", errDuplicate, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// roundTrip stands in for the network latency of a real database.
+const roundTrip = 100 * time.Microsecond
+
+func benchMockDB(b *testing.B) sqlmock.Sqlmock {
+	b.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	prev := db
+	db = sqlx.NewDb(mockDB, "postgres")
+	b.Cleanup(func() {
+		db = prev
+		mockDB.Close()
+	})
+	return mock
+}
+
+func BenchmarkCreateUsers_PerUser(b *testing.B) {
+	users := batchUsers(100)
+	mock := benchMockDB(b)
+
+	for i := 0; i < b.N; i++ {
+		for range users {
+			mock.ExpectBegin().WillDelayFor(roundTrip)
+			mock.ExpectExec("INSERT INTO users").WillDelayFor(roundTrip).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO user_tokens").WillDelayFor(roundTrip).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+		for _, u := range users {
+			if err := CreateUserWithToken(context.Background(), u); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkCreateUsers_Batch(b *testing.B) {
+	users := batchUsers(100)
+	mock := benchMockDB(b)
+
+	for i := 0; i < b.N; i++ {
+		mock.ExpectBegin().WillDelayFor(roundTrip)
+		mock.ExpectExec("INSERT INTO users").WillDelayFor(roundTrip).WillReturnResult(sqlmock.NewResult(0, 100))
+		mock.ExpectExec("INSERT INTO user_tokens").WillDelayFor(roundTrip).WillReturnResult(sqlmock.NewResult(0, 100))
+		mock.ExpectCommit()
+		if err := CreateUsersBatch(context.Background(), users); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCreateUsersBatchSkipConflicts_ReportsDuplicate(t *testing.T) {
+	mock := useMockDB(t)
+	users := batchUsers(3)
+	// user-1 takes an email that is already registered
+	users[1].Email = "taken@example.com"
+
+	mock.ExpectBegin()
+	createdAt := sameTime{first: new(time.Time)}
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (id, name, email, created_at) VALUES ($1, $2, $3, $4),($5, $6, $7, $8),($9, $10, $11, $12) ON CONFLICT DO NOTHING RETURNING id")).
+		WithArgs(
+			"user-0", "name-user-0", "user-0@example.com", createdAt,
+			"user-1", "name-user-1", "taken@example.com", createdAt,
+			"user-2", "name-user-2", "user-2@example.com", createdAt,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("user-0").AddRow("user-2"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_tokens (user_id, token, created_at) VALUES ($1, $2, $3),($4, $5, $6)")).
+		WithArgs("user-0", "token-user-0", createdAt, "user-2", "token-user-2", createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	conflicts, err := CreateUsersBatchSkipConflicts(context.Background(), users)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(conflicts, []int{1}) {
+		t.Fatalf("expected user 1 to be reported, got %v", conflicts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateUsersBatchSkipConflicts_DuplicateWithinBatch(t *testing.T) {
+	mock := useMockDB(t)
+	users := batchUsers(2)
+	users = append(users, users[0])
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users .* ON CONFLICT DO NOTHING RETURNING id").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("user-0").AddRow("user-1"))
+	mock.ExpectExec("INSERT INTO user_tokens").
+		WithArgs("user-0", "token-user-0", sqlmock.AnyArg(), "user-1", "token-user-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	conflicts, err := CreateUsersBatchSkipConflicts(context.Background(), users)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(conflicts, []int{2}) {
+		t.Fatalf("expected the repeated user to be reported, got %v", conflicts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,41 +3,131 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
-// Database configuration
+// Default database configuration, matching docker-compose.yaml
 const (
-	host     = "localhost"
-	port     = 5432
-	user     = "user"
-	password = "password"
-	dbname   = "test"
+	defaultHost     = "localhost"
+	defaultPort     = 5432
+	defaultUser     = "user"
+	defaultPassword = "password"
+	defaultDBName   = "test"
 )
 
 // DB instance
 var db *sqlx.DB
 
-func initDB() error {
-	// PostgreSQL connection string
-	dsn := fmt.Sprintf(
+// DBConfig holds the connection and pool settings used by initDB.
+type DBConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// TxTimeout bounds a single transaction, see TxTimeout.
+	TxTimeout time.Duration
+}
+
+// DBConfigFromEnv reads DB_HOST, DB_PORT, DB_USER, DB_PASSWORD, DB_NAME, DB_MAX_OPEN_CONNS,
+// DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME and DB_TX_TIMEOUT (durations such as 5m), falling
+// back to the defaults for the ones that are not set.
+func DBConfigFromEnv() (cfg DBConfig, err error) {
+	cfg = DBConfig{
+		Host:     envOr("DB_HOST", defaultHost),
+		User:     envOr("DB_USER", defaultUser),
+		Password: envOr("DB_PASSWORD", defaultPassword),
+		Name:     envOr("DB_NAME", defaultDBName),
+	}
+
+	if cfg.Port, err = envInt("DB_PORT", defaultPort); err != nil {
+		return DBConfig{}, err
+	}
+	if cfg.MaxOpenConns, err = envInt("DB_MAX_OPEN_CONNS", 10); err != nil {
+		return DBConfig{}, err
+	}
+	if cfg.MaxIdleConns, err = envInt("DB_MAX_IDLE_CONNS", 5); err != nil {
+		return DBConfig{}, err
+	}
+
+	if cfg.ConnMaxLifetime, err = envDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute); err != nil {
+		return DBConfig{}, err
+	}
+	if cfg.TxTimeout, err = envDuration("DB_TX_TIMEOUT", TxTimeout); err != nil {
+		return DBConfig{}, err
+	}
+	return cfg, nil
+}
+
+// DSN returns the PostgreSQL connection string for the config.
+func (c DBConfig) DSN() string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname,
+		c.Host, c.Port, c.User, c.Password, c.Name,
 	)
+}
+
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return n, nil
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return d, nil
+}
+
+// initDB connects using the settings from DBConfigFromEnv. A non-empty dsn replaces the
+// connection settings, the pool settings still come from the environment.
+func initDB(dsn string) error {
+	cfg, err := DBConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to read database config: %w", err)
+	}
+	if dsn == "" {
+		dsn = cfg.DSN()
+	}
 
-	var err error
 	db, err = sqlx.Connect("postgres", dsn)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	// Set connection settings
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Minute * 5)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	TxTimeout = cfg.TxTimeout
 
 	log.Println("Connected to PostgreSQL successfully!")
 	return nil
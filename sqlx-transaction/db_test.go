@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDBConfigFromEnv_Defaults(t *testing.T) {
+	for _, key := range []string{"DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME", "DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_TX_TIMEOUT"} {
+		// t.Setenv restores the variable afterwards, Unsetenv alone would leak
+		t.Setenv(key, "")
+		unsetenv(t, key)
+	}
+
+	cfg, err := DBConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := DBConfig{
+		Host:            "localhost",
+		Port:            5432,
+		User:            "user",
+		Password:        "password",
+		Name:            "test",
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 5 * time.Minute,
+		TxTimeout:       30 * time.Second,
+	}
+	if cfg != want {
+		t.Fatalf("expected %+v, got %+v", want, cfg)
+	}
+	if dsn := cfg.DSN(); dsn != "host=localhost port=5432 user=user password=password dbname=test sslmode=disable" {
+		t.Fatalf("unexpected dsn %q", dsn)
+	}
+}
+
+func TestDBConfigFromEnv_Overrides(t *testing.T) {
+	t.Setenv("DB_HOST", "postgres")
+	t.Setenv("DB_PORT", "6543")
+	t.Setenv("DB_NAME", "ci")
+	t.Setenv("DB_MAX_OPEN_CONNS", "20")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "30s")
+
+	cfg, err := DBConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Host != "postgres" || cfg.Port != 6543 || cfg.Name != "ci" {
+		t.Errorf("connection settings not read from env: %+v", cfg)
+	}
+	if cfg.MaxOpenConns != 20 || cfg.ConnMaxLifetime != 30*time.Second {
+		t.Errorf("pool settings not read from env: %+v", cfg)
+	}
+}
+
+func TestDBConfigFromEnv_InvalidPort(t *testing.T) {
+	t.Setenv("DB_PORT", "not-a-port")
+
+	if _, err := DBConfigFromEnv(); err == nil {
+		t.Fatal("expected an invalid DB_PORT to be rejected")
+	}
+}
+
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+	if err := os.Unsetenv(key); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeleteUsers(t *testing.T) {
+	mock := useMockDB(t)
+	ids := []string{"id-1", "id-2", "id-3"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_tokens WHERE user_id IN ($1, $2, $3)")).
+		WithArgs("id-1", "id-2", "id-3").
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id IN ($1, $2, $3)")).
+		WithArgs("id-1", "id-2", "id-3").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	deleted, err := DeleteUsers(context.Background(), ids)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// id-3 did not exist, only the rows actually deleted are counted
+	if deleted != 2 {
+		t.Fatalf("expected 2 deleted, got %d", deleted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteUsers_RollbackOnError(t *testing.T) {
+	mock := useMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM user_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM users").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	deleted, err := DeleteUsers(context.Background(), []string{"id-1"})
+
+	if err == nil || deleted != 0 {
+		t.Fatalf("expected failure with nothing deleted, got deleted=%d err=%v", deleted, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteUsers_EmptyInput(t *testing.T) {
+	mock := useMockDB(t)
+
+	deleted, err := DeleteUsers(context.Background(), nil)
+
+	if err != nil || deleted != 0 {
+		t.Fatalf("expected a no-op, got deleted=%d err=%v", deleted, err)
+	}
+	// no expectations were set, so any query would have failed the mock
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
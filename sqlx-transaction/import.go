@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// RowError describes why a CSV row could not be imported.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ImportErrors collects the per-row errors of an import. Rows that failed are skipped,
+// the remaining rows are still imported.
+type ImportErrors []RowError
+
+func (e ImportErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, rowErr := range e {
+		msgs[i] = rowErr.Error()
+	}
+	return fmt.Sprintf("%d row(s) failed to import: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// ImportUsersCSV reads name,email rows and inserts the valid ones in a single transaction.
+// Rows whose email already exists, either in the database or earlier in the file, are skipped.
+// Invalid rows are skipped too and reported through an ImportErrors error.
+func ImportUsersCSV(ctx context.Context, r io.Reader) (imported int, skipped int, err error) {
+	users, skipped, rowErrs, err := parseUsersCSV(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(users) > 0 {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+
+		newUsers, err := insertNewUsers(ctx, tx, users)
+		if err != nil {
+			tx.Rollback()
+			return 0, 0, err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		imported = len(newUsers)
+		skipped += len(users) - len(newUsers)
+	}
+
+	if len(rowErrs) > 0 {
+		return imported, skipped, rowErrs
+	}
+	return imported, skipped, nil
+}
+
+func parseUsersCSV(r io.Reader) (users []User, skipped int, rowErrs ImportErrors, err error) {
+	reader := csv.NewReader(r)
+	// rows with the wrong number of fields are reported per row instead of aborting the import
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	seen := make(map[string]bool)
+	for line := 1; ; line++ {
+		record, readErr := reader.Read()
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			var parseErr *csv.ParseError
+			if errors.As(readErr, &parseErr) {
+				rowErrs = append(rowErrs, RowError{Line: line, Err: readErr})
+				skipped++
+				continue
+			}
+			return nil, 0, nil, fmt.Errorf("failed to read csv: %w", readErr)
+		}
+
+		// allow an optional header row
+		if line == 1 && len(record) == 2 && strings.EqualFold(record[0], "name") && strings.EqualFold(record[1], "email") {
+			continue
+		}
+
+		user, validateErr := userFromRecord(record)
+		if validateErr != nil {
+			rowErrs = append(rowErrs, RowError{Line: line, Err: validateErr})
+			skipped++
+			continue
+		}
+
+		if seen[user.Email] {
+			skipped++
+			continue
+		}
+		seen[user.Email] = true
+		users = append(users, user)
+	}
+
+	return users, skipped, rowErrs, nil
+}
+
+func userFromRecord(record []string) (User, error) {
+	if len(record) != 2 {
+		return User{}, fmt.Errorf("expected 2 fields (name,email), got %d", len(record))
+	}
+
+	name := strings.TrimSpace(record[0])
+	email := strings.ToLower(strings.TrimSpace(record[1]))
+	if name == "" {
+		return User{}, errors.New("name is required")
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		return User{}, fmt.Errorf("invalid email %q", email)
+	}
+
+	userID, err := uuid.NewV4()
+	if err != nil {
+		return User{}, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+	return User{ID: userID.String(), Name: name, Email: email}, nil
+}
+
+// insertNewUsers inserts the users whose email is not taken yet and returns them. Emails
+// are compared case-insensitively, rows inserted elsewhere may not be lowercased. Both
+// the lookup and the insert run in chunks of maxBatchRows to stay under the Postgres
+// parameter limit.
+func insertNewUsers(ctx context.Context, tx *sqlx.Tx, users []User) ([]User, error) {
+	taken := make(map[string]bool)
+	for start := 0; start < len(users); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(users))
+
+		emails := make([]string, 0, end-start)
+		for _, u := range users[start:end] {
+			emails = append(emails, u.Email)
+		}
+
+		query, args, err := sqlx.In("SELECT LOWER(email) FROM users WHERE LOWER(email) IN (?)", emails)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build existing emails query: %w", err)
+		}
+
+		var existing []string
+		err = tx.SelectContext(ctx, &existing, tx.Rebind(query), args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get existing emails: %w", err)
+		}
+		for _, email := range existing {
+			taken[email] = true
+		}
+	}
+
+	newUsers := make([]User, 0, len(users))
+	for _, u := range users {
+		if !taken[u.Email] {
+			newUsers = append(newUsers, u)
+		}
+	}
+
+	query := "INSERT INTO users (id, name, email, created_at) VALUES (:id, :name, :email, NOW())"
+	for start := 0; start < len(newUsers); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(newUsers))
+		if _, err := tx.NamedExecContext(ctx, query, newUsers[start:end]); err != nil {
+			return nil, fmt.Errorf("failed to bulk insert users: %w", err)
+		}
+	}
+	return newUsers, nil
+}
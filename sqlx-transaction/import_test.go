@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestImportUsersCSV(t *testing.T) {
+	mock := useMockDB(t)
+
+	csvData := strings.Join([]string{
+		"name,email",
+		"Alice,alice@example.com",
+		"Bob,not-an-email",
+		"Charlie,charlie@example.com,extra",
+		"Dave,alice@example.com",
+		"Eve,eve@example.com",
+	}, "\n")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT LOWER(email) FROM users WHERE LOWER(email) IN ($1, $2)")).
+		WithArgs("alice@example.com", "eve@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}).AddRow("eve@example.com"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name, email, created_at) VALUES ($1, $2, $3, NOW())")).
+		WithArgs(sqlmock.AnyArg(), "Alice", "alice@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	imported, skipped, err := ImportUsersCSV(context.Background(), strings.NewReader(csvData))
+
+	if imported != 1 {
+		t.Errorf("expected 1 imported, got %d", imported)
+	}
+	// Bob (invalid email), Charlie (malformed row), Dave (duplicate in file) and Eve (already exists)
+	if skipped != 4 {
+		t.Errorf("expected 4 skipped, got %d", skipped)
+	}
+
+	var rowErrs ImportErrors
+	if !errors.As(err, &rowErrs) {
+		t.Fatalf("expected ImportErrors, got %v", err)
+	}
+	if len(rowErrs) != 2 || rowErrs[0].Line != 3 || rowErrs[1].Line != 4 {
+		t.Fatalf("expected errors for lines 3 and 4, got %v", rowErrs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportUsersCSV_RollbackOnInsertError(t *testing.T) {
+	mock := useMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT LOWER(email) FROM users WHERE LOWER(email) IN ($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectExec("INSERT INTO users").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	imported, _, err := ImportUsersCSV(context.Background(), strings.NewReader("Alice,alice@example.com\n"))
+
+	if err == nil || imported != 0 {
+		t.Fatalf("expected failure with nothing imported, got imported=%d err=%v", imported, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportUsersCSV_ExistingEmailInAnotherCase(t *testing.T) {
+	mock := useMockDB(t)
+
+	// the table holds John@Example.com, which LOWER(email) matches
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT LOWER(email) FROM users WHERE LOWER(email) IN ($1)")).
+		WithArgs("john@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}).AddRow("john@example.com"))
+	mock.ExpectCommit()
+
+	imported, skipped, err := ImportUsersCSV(context.Background(), strings.NewReader("John,JOHN@example.com\n"))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if imported != 0 || skipped != 1 {
+		t.Fatalf("expected the user to be skipped as a duplicate, got imported=%d skipped=%d", imported, skipped)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportUsersCSV_ChunksLargeFiles(t *testing.T) {
+	mock := useMockDB(t)
+
+	rows := make([]string, maxBatchRows+1)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("User %d,user%d@example.com", i, i)
+	}
+
+	// two lookups and two inserts keep every statement under the parameter limit
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT LOWER(email) FROM users WHERE LOWER(email) IN (")).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT LOWER(email) FROM users WHERE LOWER(email) IN ($1)")).
+		WithArgs(fmt.Sprintf("user%d@example.com", maxBatchRows)).
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(0, maxBatchRows))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name, email, created_at) VALUES ($1, $2, $3, NOW())")).
+		WithArgs(sqlmock.AnyArg(), fmt.Sprintf("User %d", maxBatchRows), fmt.Sprintf("user%d@example.com", maxBatchRows)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	imported, _, err := ImportUsersCSV(context.Background(), strings.NewReader(strings.Join(rows, "\n")))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if imported != maxBatchRows+1 {
+		t.Fatalf("expected %d imported, got %d", maxBatchRows+1, imported)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
@@ -18,60 +25,119 @@ type User struct {
 	Email string `db:"email"`
 }
 
+// ErrUserNotFound is returned when no user has the requested ID.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrNoUsers is returned by GetAllUserAndTokensOrErr when there is no user with a token.
+var ErrNoUsers = errors.New("no users found")
+
+// UserWithToken is a user joined with one of its tokens.
+type UserWithToken struct {
+	User
+	Token string `db:"token"`
+}
+
 func main() {
-	err := initDB()
+	// an interrupt cancels ctx, which aborts the in-flight transactions instead of leaving them open
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := initDB("")
 	if err != nil {
 		log.Fatalf("Database initialization failed: %v", err)
 	}
-	defer db.Close()
 
-	multipleUserCreate()
+	if err := run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run creates the users with their tokens and prints every user and token, until ctx is
+// cancelled. It closes the database before returning.
+func run(ctx context.Context) (err error) {
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			log.Println("Failed to close database:", closeErr)
+		}
+	}()
+
+	ids, err := multipleUserCreate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create users with tokens (%d created): %w", len(ids), err)
+	}
+	fmt.Printf("All %d users and tokens created successfully.\n", len(ids))
 
-	ctx := context.Background()
 	// get all users and tokens
 	users, err := GetAllUserAndTokens(ctx)
 	if err != nil {
-		log.Fatalf("Failed to get all users and tokens: %v", err)
+		return fmt.Errorf("failed to get all users and tokens: %w", err)
 	}
 
 	for _, u := range users {
-		fmt.Printf("User: %s, Email: %s\n", u.Name, u.Email)
+		fmt.Printf("User: %s, Email: %s, Token: %s\n", u.Name, u.Email, u.Token)
 	}
-
+	return nil
 }
 
-func multipleUserCreate() {
-	var wg sync.WaitGroup
-	ctx := context.Background()
+// multipleUserCreate concurrently creates five random users with their tokens. It returns
+// the IDs of the users that were created, and the first error if any creation failed.
+func multipleUserCreate(ctx context.Context) ([]string, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		ids      []string
+		firstErr error
+	)
 
 	for i := 0; i < 5; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			userID, err := uuid.NewV4()
-			if err != nil {
-				log.Fatalf("Failed to generate UUID: %v", err)
-			}
-
-			user := User{
-				ID:    userID.String(),
-				Name:  generateRandomName(),
-				Email: generateRandomEmail(),
-			}
+			id, err := createRandomUser(ctx)
 
-			err = CreateUserWithToken(ctx, user)
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
-				log.Fatalf("Failed to create user with token: %v", err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
 			}
+			ids = append(ids, id)
 		}()
 	}
 
 	wg.Wait()
-	fmt.Println("All users and tokens created successfully.")
+	return ids, firstErr
+}
+
+func createRandomUser(ctx context.Context) (string, error) {
+	userID, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	user := User{
+		ID:    userID.String(),
+		Name:  generateRandomName(),
+		Email: generateRandomEmail(),
+	}
 
+	err = CreateUserWithTokenRetry(ctx, user, 3, 50*time.Millisecond)
+	if err != nil {
+		return "", fmt.Errorf("failed to create user with token: %w", err)
+	}
+	return user.ID, nil
 }
 
-func CreateUserWithToken(ctx context.Context, user User) error {
+// TxTimeout bounds how long CreateUserWithToken's transaction may run, a statement still
+// running when it expires is aborted and the transaction rolled back.
+var TxTimeout = 30 * time.Second
+
+func CreateUserWithToken(ctx context.Context, user User) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, TxTimeout)
+	defer cancel()
+
 	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -79,7 +145,14 @@ func CreateUserWithToken(ctx context.Context, user User) error {
 
 	defer func() {
 		if err != nil {
-			tx.Rollback()
+			// a failed commit has already ended the transaction, there is nothing left to roll back
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+				log.Printf("failed to rollback transaction: %v", rbErr)
+			}
+			// drivers report an aborted statement in their own words, keep the cause visible
+			if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+				err = fmt.Errorf("%w: %w", ctxErr, err)
+			}
 		}
 	}()
 
@@ -94,12 +167,40 @@ func CreateUserWithToken(ctx context.Context, user User) error {
 		return err
 	}
 
-	return tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateUserWithTokenRetry runs CreateUserWithToken, starting over in a new transaction
+// when it fails with a serialization failure or deadlock, up to maxAttempts times in total.
+// Retries wait baseDelay, doubled per retry, with jitter so concurrent writers spread out.
+func CreateUserWithTokenRetry(ctx context.Context, user User, maxAttempts int, baseDelay time.Duration) error {
+	policy := RetryPolicy{
+		MaxAttempts: maxAttempts,
+		Backoff:     baseDelay,
+		Jitter:      0.5,
+	}
+	return retry(ctx, policy, func() error {
+		// the token is generated again inside every attempt
+		return CreateUserWithToken(ctx, user)
+	})
 }
 
 func CreateUser(ctx context.Context, tx *sqlx.Tx, user *User) error {
-	query := "INSERT INTO users (id, name, email, created_at) VALUES (:id, :name, :email, NOW())"
-	_, err := tx.ExecContext(ctx, query, user)
+	return CreateUserAt(ctx, tx, user, time.Now())
+}
+
+// CreateUserAt is CreateUser with an explicit created_at instead of the current time.
+func CreateUserAt(ctx context.Context, tx *sqlx.Tx, user *User, createdAt time.Time) error {
+	row := struct {
+		User
+		CreatedAt time.Time `db:"created_at"`
+	}{*user, createdAt}
+
+	query := "INSERT INTO users (id, name, email, created_at) VALUES (:id, :name, :email, :created_at)"
+	_, err := tx.NamedExecContext(ctx, query, row)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -107,8 +208,13 @@ func CreateUser(ctx context.Context, tx *sqlx.Tx, user *User) error {
 }
 
 func CreateUserToken(ctx context.Context, tx *sqlx.Tx, userID, token string) error {
-	query := "INSERT INTO user_tokens (user_id, token, created_at) VALUES ($1, $2, NOW())"
-	_, err := tx.ExecContext(ctx, query, userID, token)
+	return CreateUserTokenAt(ctx, tx, userID, token, time.Now())
+}
+
+// CreateUserTokenAt is CreateUserToken with an explicit created_at instead of the current time.
+func CreateUserTokenAt(ctx context.Context, tx *sqlx.Tx, userID, token string, createdAt time.Time) error {
+	query := "INSERT INTO user_tokens (user_id, token, created_at) VALUES ($1, $2, $3)"
+	_, err := tx.ExecContext(ctx, query, userID, token, createdAt)
 	if err != nil {
 		return fmt.Errorf("failed to create user token: %w", err)
 	}
@@ -119,13 +225,15 @@ func generateToken(userID string) string {
 	return fmt.Sprintf("token-%s", userID)
 }
 
-func GetAllUserAndTokens(ctx context.Context) ([]User, error) {
+// GetAllUserAndTokens returns one row per token, so a user with several tokens appears
+// once for each of them and users without tokens are left out.
+func GetAllUserAndTokens(ctx context.Context) ([]UserWithToken, error) {
 	query := `
-		SELECT u.id, u.name, u.email
+		SELECT u.id, u.name, u.email, ut.token
 		FROM users u
 		JOIN user_tokens ut ON u.id = ut.user_id
 	`
-	var users []User
+	var users []UserWithToken
 	err := db.SelectContext(ctx, &users, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all users: %w", err)
@@ -134,9 +242,221 @@ func GetAllUserAndTokens(ctx context.Context) ([]User, error) {
 	return users, nil
 }
 
+// GetAllUserAndTokensOrErr is GetAllUserAndTokens, except it returns ErrNoUsers instead of
+// an empty result, so callers can tell there is nothing apart from a failure.
+func GetAllUserAndTokensOrErr(ctx context.Context) ([]UserWithToken, error) {
+	users, err := GetAllUserAndTokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNoUsers
+	}
+	return users, nil
+}
+
+// GetUserWithTokens returns the user with the given ID and all of its tokens, which is
+// empty if the user has none. It returns ErrUserNotFound if there is no such user.
+func GetUserWithTokens(ctx context.Context, id string) (*User, []string, error) {
+	query := `
+		SELECT u.id, u.name, u.email, ut.token
+		FROM users u
+		LEFT JOIN user_tokens ut ON u.id = ut.user_id
+		WHERE u.id = $1
+		ORDER BY ut.created_at
+	`
+	var rows []struct {
+		User
+		// NULL when the user has no tokens
+		Token sql.NullString `db:"token"`
+	}
+	err := db.SelectContext(ctx, &rows, query, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user with tokens: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, ErrUserNotFound
+	}
+
+	user := rows[0].User
+	tokens := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Token.Valid {
+			tokens = append(tokens, row.Token.String)
+		}
+	}
+	return &user, tokens, nil
+}
+
+// GetUsersAndTokensPaginated returns one page of GetAllUserAndTokens ordered by user ID
+// and token, and whether more rows follow it.
+func GetUsersAndTokensPaginated(ctx context.Context, limit, offset int) (users []UserWithToken, hasMore bool, err error) {
+	if limit <= 0 {
+		return nil, false, fmt.Errorf("invalid page limit %d", limit)
+	}
+
+	query := `
+		SELECT u.id, u.name, u.email, ut.token
+		FROM users u
+		JOIN user_tokens ut ON u.id = ut.user_id
+		ORDER BY u.id, ut.token
+		LIMIT $1 OFFSET $2
+	`
+	// one extra row tells whether there is a next page
+	err = db.SelectContext(ctx, &users, query, limit+1, offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get users page: %w", err)
+	}
+
+	return trimPage(users, limit)
+}
+
+// GetUsersAndTokensAfter is the keyset form of GetUsersAndTokensPaginated: it returns the
+// page following the row of afterID and afterToken, the last row of the previous page, or
+// the first page when both are empty. Unlike offsets, the pages stay stable while users
+// are inserted or deleted.
+func GetUsersAndTokensAfter(ctx context.Context, afterID, afterToken string, limit int) (users []UserWithToken, hasMore bool, err error) {
+	if limit <= 0 {
+		return nil, false, fmt.Errorf("invalid page limit %d", limit)
+	}
+
+	query := `
+		SELECT u.id, u.name, u.email, ut.token
+		FROM users u
+		JOIN user_tokens ut ON u.id = ut.user_id
+		WHERE (u.id, ut.token) > ($1, $2)
+		ORDER BY u.id, ut.token
+		LIMIT $3
+	`
+	err = db.SelectContext(ctx, &users, query, afterID, afterToken, limit+1)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get users page: %w", err)
+	}
+
+	return trimPage(users, limit)
+}
+
+func trimPage(users []UserWithToken, limit int) ([]UserWithToken, bool, error) {
+	if len(users) > limit {
+		return users[:limit], true, nil
+	}
+	return users, false, nil
+}
+
+// DeleteUsers deletes the given users and their tokens in a single transaction and
+// returns how many users were actually deleted. An empty ids slice is a no-op.
+func DeleteUsers(ctx context.Context, ids []string) (deleted int, err error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query, args, err := sqlx.In("DELETE FROM user_tokens WHERE user_id IN (?)", ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build delete tokens query: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+		return 0, fmt.Errorf("failed to delete user tokens: %w", err)
+	}
+
+	query, args, err = sqlx.In("DELETE FROM users WHERE id IN (?)", ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build delete users query: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, tx.Rebind(query), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete users: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get deleted users count: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(rows), nil
+}
+
+// NameGenerator picks names with a probability proportional to their weight,
+// so generated datasets can have some names more common than others.
+type NameGenerator struct {
+	// mu guards rnd, which is not safe for concurrent use
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	names   []string
+	weights []int
+	total   int
+}
+
+// NewNameGenerator builds a generator from a name -> weight map. Names with a
+// non-positive weight are never picked. The seed makes the sequence reproducible.
+func NewNameGenerator(weights map[string]int, seed int64) *NameGenerator {
+	// sort the names so the same seed always yields the same sequence,
+	// regardless of map iteration order
+	names := make([]string, 0, len(weights))
+	for name, weight := range weights {
+		if weight > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	g := &NameGenerator{
+		rnd:     rand.New(rand.NewSource(seed)),
+		names:   names,
+		weights: make([]int, len(names)),
+	}
+	for i, name := range names {
+		g.weights[i] = weights[name]
+		g.total += weights[name]
+	}
+	return g
+}
+
+// Next returns a weighted random name, or an empty string if no name has a positive weight.
+func (g *NameGenerator) Next() string {
+	if g.total == 0 {
+		return ""
+	}
+
+	g.mu.Lock()
+	n := g.rnd.Intn(g.total)
+	g.mu.Unlock()
+	for i, weight := range g.weights {
+		if n < weight {
+			return g.names[i]
+		}
+		n -= weight
+	}
+	return g.names[len(g.names)-1]
+}
+
+// nameGenerator picks the names of the generated users, the common ones more often.
+var nameGenerator = NewNameGenerator(map[string]int{
+	"Alice":   20,
+	"Bob":     20,
+	"Charlie": 15,
+	"David":   15,
+	"Eve":     10,
+	"Frank":   10,
+	"Grace":   5,
+	"Hannah":  5,
+}, time.Now().UnixNano())
+
 func generateRandomName() string {
-	names := []string{"Alice", "Bob", "Charlie", "David", "Eve", "Frank", "Grace", "Hannah"}
-	return names[rand.Intn(len(names))]
+	return nameGenerator.Next()
 }
 
 func generateRandomEmail() string {
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNameGenerator_WeightedDistribution(t *testing.T) {
+	weights := map[string]int{
+		"Alice":   6,
+		"Bob":     3,
+		"Charlie": 1,
+		"Ignored": 0,
+	}
+	gen := NewNameGenerator(weights, 42)
+
+	const draws = 20000
+	counts := make(map[string]int)
+	for i := 0; i < draws; i++ {
+		counts[gen.Next()]++
+	}
+
+	if counts["Ignored"] != 0 {
+		t.Fatalf("expected zero-weight name to never be picked, got %d", counts["Ignored"])
+	}
+
+	const tolerance = 0.02
+	for name, weight := range map[string]int{"Alice": 6, "Bob": 3, "Charlie": 1} {
+		want := float64(weight) / 10
+		got := float64(counts[name]) / draws
+		if math.Abs(got-want) > tolerance {
+			t.Errorf("%s: expected ratio %.2f, got %.4f", name, want, got)
+		}
+	}
+}
+
+func TestNameGenerator_SameSeedSameSequence(t *testing.T) {
+	weights := map[string]int{"Alice": 2, "Bob": 1}
+	a := NewNameGenerator(weights, 7)
+	b := NewNameGenerator(weights, 7)
+
+	for i := 0; i < 100; i++ {
+		if x, y := a.Next(), b.Next(); x != y {
+			t.Fatalf("draw %d: sequences diverged (%s != %s)", i, x, y)
+		}
+	}
+}
+
+func TestGenerateRandomName_UsesNameGenerator(t *testing.T) {
+	orig := nameGenerator
+	nameGenerator = NewNameGenerator(map[string]int{"Alice": 1, "Bob": 0}, 1)
+	t.Cleanup(func() { nameGenerator = orig })
+
+	for i := 0; i < 100; i++ {
+		if name := generateRandomName(); name != "Alice" {
+			t.Fatalf("expected only the weighted name, got %q", name)
+		}
+	}
+	if email := generateRandomEmail(); !strings.HasPrefix(email, "Alice@") {
+		t.Fatalf("expected the email to use the weighted name, got %q", email)
+	}
+}
+
+func TestMultipleUserCreate_PartialFailure(t *testing.T) {
+	mock := useMockDB(t)
+	mock.MatchExpectationsInOrder(false)
+
+	errBoom := errors.New("boom")
+	for i := 0; i < 5; i++ {
+		mock.ExpectBegin()
+	}
+	for i := 0; i < 4; i++ {
+		mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO user_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectExec("INSERT INTO users").WillReturnError(errBoom)
+	mock.ExpectRollback()
+
+	ids, err := multipleUserCreate(context.Background())
+
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected %v, got %v", errBoom, err)
+	}
+	if len(ids) != 4 {
+		t.Fatalf("expected the 4 created IDs, got %v", ids)
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			t.Fatalf("expected distinct non-empty IDs, got %v", ids)
+		}
+		seen[id] = true
+	}
+}
+
+func TestMultipleUserCreate_CancelledContext(t *testing.T) {
+	// no statement is expected, sqlmock fails on any
+	mock := useMockDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ids, err := multipleUserCreate(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("expected no user to be created, got %v", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_CancelledContextClosesDB(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectClose()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expected the database to be closed: %v", err)
+	}
+}
+
+func TestCreateUserAt_UsesInjectedCreatedAt(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	ctx := context.Background()
+	user := User{ID: "id-1", Name: "John", Email: "john@example.com"}
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name, email, created_at) VALUES ($1, $2, $3, $4)")).
+		WithArgs(user.ID, user.Name, user.Email, createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_tokens (user_id, token, created_at) VALUES ($1, $2, $3)")).
+		WithArgs(user.ID, "token-id-1", createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := sqlxDB.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateUserAt(ctx, tx, &user, createdAt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CreateUserTokenAt(ctx, tx, user.ID, "token-id-1", createdAt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func userRows(ids ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "token"})
+	for _, id := range ids {
+		rows.AddRow(id, "name-"+id, id+"@example.com", generateToken(id))
+	}
+	return rows
+}
+
+func TestGetUsersAndTokensPaginated(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     []string
+		wantIDs  []string
+		wantMore bool
+	}{
+		{"more pages", []string{"a", "b", "c"}, []string{"a", "b"}, true},
+		{"last page", []string{"a"}, []string{"a"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.ExpectQuery(`ORDER BY u\.id, ut\.token\s+LIMIT \$1 OFFSET \$2`).
+				WithArgs(3, 4).
+				WillReturnRows(userRows(tt.rows...))
+
+			users, hasMore, err := GetUsersAndTokensPaginated(context.Background(), 2, 4)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertUserIDs(t, users, tt.wantIDs)
+			if hasMore != tt.wantMore {
+				t.Errorf("expected hasMore %v, got %v", tt.wantMore, hasMore)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGetUsersAndTokensAfter(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`WHERE \(u\.id, ut\.token\) > \(\$1, \$2\)\s+ORDER BY u\.id, ut\.token\s+LIMIT \$3`).
+		WithArgs("b", "token-b", 3).
+		WillReturnRows(userRows("c", "d", "e"))
+
+	users, hasMore, err := GetUsersAndTokensAfter(context.Background(), "b", "token-b", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertUserIDs(t, users, []string{"c", "d"})
+	if !hasMore {
+		t.Error("expected hasMore")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetUsersAndTokensPaginated_InvalidLimit(t *testing.T) {
+	if _, _, err := GetUsersAndTokensPaginated(context.Background(), 0, 0); err == nil {
+		t.Fatal("expected error for a zero limit")
+	}
+}
+
+func assertUserIDs(t *testing.T, users []UserWithToken, want []string) {
+	t.Helper()
+	if len(users) != len(want) {
+		t.Fatalf("expected users %v, got %v", want, users)
+	}
+	for i, u := range users {
+		if u.ID != want[i] {
+			t.Fatalf("expected users %v, got %v", want, users)
+		}
+	}
+}
+
+func TestGetAllUserAndTokens_OneRowPerToken(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT u\.id, u\.name, u\.email, ut\.token`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "token"}).
+			AddRow("a", "Alice", "alice@example.com", "token-1").
+			AddRow("a", "Alice", "alice@example.com", "token-2").
+			AddRow("b", "Bob", "bob@example.com", "token-3"))
+
+	users, err := GetAllUserAndTokens(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []UserWithToken{
+		{User: User{ID: "a", Name: "Alice", Email: "alice@example.com"}, Token: "token-1"},
+		{User: User{ID: "a", Name: "Alice", Email: "alice@example.com"}, Token: "token-2"},
+		{User: User{ID: "b", Name: "Bob", Email: "bob@example.com"}, Token: "token-3"},
+	}
+	if len(users) != len(want) {
+		t.Fatalf("expected %d rows, got %d", len(want), len(users))
+	}
+	for i := range want {
+		if users[i] != want[i] {
+			t.Errorf("row %d: expected %+v, got %+v", i, want[i], users[i])
+		}
+	}
+}
+
+func TestGetAllUserAndTokensOrErr(t *testing.T) {
+	columns := []string{"id", "name", "email", "token"}
+
+	t.Run("no users", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery(`SELECT u\.id, u\.name, u\.email, ut\.token`).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		users, err := GetAllUserAndTokensOrErr(context.Background())
+		if !errors.Is(err, ErrNoUsers) {
+			t.Fatalf("expected %v, got %v", ErrNoUsers, err)
+		}
+		if users != nil {
+			t.Fatalf("expected no users, got %v", users)
+		}
+	})
+
+	t.Run("users", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery(`SELECT u\.id, u\.name, u\.email, ut\.token`).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("a", "Alice", "alice@example.com", "token-1"))
+
+		users, err := GetAllUserAndTokensOrErr(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := UserWithToken{User: User{ID: "a", Name: "Alice", Email: "alice@example.com"}, Token: "token-1"}
+		if len(users) != 1 || users[0] != want {
+			t.Fatalf("expected [%+v], got %+v", want, users)
+		}
+	})
+
+	t.Run("query error is not ErrNoUsers", func(t *testing.T) {
+		mock := useMockDB(t)
+		errBoom := errors.New("boom")
+		mock.ExpectQuery(`SELECT u\.id, u\.name, u\.email, ut\.token`).WillReturnError(errBoom)
+
+		_, err := GetAllUserAndTokensOrErr(context.Background())
+		if !errors.Is(err, errBoom) || errors.Is(err, ErrNoUsers) {
+			t.Fatalf("expected %v, got %v", errBoom, err)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Postgres error codes of transactions that can succeed when run again.
+const (
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+// RetryPolicy controls how WithTxRetry retries a failed transaction.
+// Zero fields fall back to the defaults of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles for every further retry.
+	Backoff time.Duration
+	// Jitter randomly shortens each delay by up to this fraction of it, 0 disables it.
+	Jitter float64
+	// Retryable decides whether an attempt's error is worth retrying.
+	Retryable func(err error) bool
+	// Logger receives one entry per retry, it is optional.
+	Logger *slog.Logger
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     50 * time.Millisecond,
+		Retryable:   IsRetryableTxError,
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = defaults.Backoff
+	}
+	if p.Retryable == nil {
+		p.Retryable = defaults.Retryable
+	}
+	return p
+}
+
+// IsRetryableTxError reports whether err is a Postgres serialization failure or deadlock.
+func IsRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected
+}
+
+// WithTxRetry runs fn through WithTx, starting a new transaction for every attempt that
+// fails with an error the policy considers retryable. fn must be safe to run again.
+func WithTxRetry(ctx context.Context, db *sqlx.DB, publisher EventPublisher, policy RetryPolicy, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+	return retry(ctx, policy, func() error {
+		return WithTx(ctx, db, publisher, fn)
+	})
+}
+
+// retry runs attempt until it succeeds, fails with an error that is not retryable,
+// or the policy runs out of attempts, and returns the last error.
+func retry(ctx context.Context, policy RetryPolicy, attempt func() error) error {
+	policy = policy.withDefaults()
+	backoff := policy.Backoff
+
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= policy.MaxAttempts || !policy.Retryable(err) {
+			return err
+		}
+
+		delay := policy.jitter(backoff)
+		if policy.Logger != nil {
+			policy.Logger.LogAttrs(ctx, slog.LevelWarn, "retrying transaction",
+				slog.Int("attempt", n),
+				slog.Any("error", err),
+				slog.Duration("delay", delay),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+func (p RetryPolicy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return delay
+	}
+	return delay - time.Duration(rand.Float64()*p.Jitter*float64(delay))
+}
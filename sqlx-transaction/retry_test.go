@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// recordingHandler is a slog.Handler keeping every record it receives.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func TestWithTxRetry_LogsEachRetry(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	handler := &recordingHandler{}
+
+	serializationErr := &pq.Error{Code: pqSerializationFailure, Message: "could not serialize access"}
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnError(serializationErr)
+		mock.ExpectRollback()
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Logger: slog.New(handler)}
+	err := WithTxRetry(context.Background(), sqlxDB, nil, policy, func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE users SET name = $1", "john")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(handler.records) != 2 {
+		t.Fatalf("expected one log line per retry, got %d", len(handler.records))
+	}
+	for i, record := range handler.records {
+		attrs := recordAttrs(record)
+		if got := attrs["attempt"].Int64(); got != int64(i+1) {
+			t.Errorf("record %d: expected attempt %d, got %d", i, i+1, got)
+		}
+		if logged, ok := attrs["error"].Any().(error); !ok || !errors.Is(logged, serializationErr) {
+			t.Errorf("record %d: expected the serialization failure, got %v", i, attrs["error"])
+		}
+		if got, want := attrs["delay"].Duration(), time.Millisecond<<i; got != want {
+			t.Errorf("record %d: expected delay %v, got %v", i, want, got)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTxRetry_DoesNotRetryOtherErrors(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	handler := &recordingHandler{}
+
+	errBoom := errors.New("boom")
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	policy := RetryPolicy{Backoff: time.Millisecond, Logger: slog.New(handler)}
+	err := WithTxRetry(context.Background(), sqlxDB, nil, policy, func(ctx context.Context, tx *sqlx.Tx) error {
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected %v, got %v", errBoom, err)
+	}
+	if len(handler.records) != 0 {
+		t.Fatalf("expected no retries to be logged, got %d", len(handler.records))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectCreateUserWithToken(mock sqlmock.Sqlmock, user User, insertErr error) {
+	mock.ExpectBegin()
+	insert := mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name, email, created_at) VALUES ($1, $2, $3, $4)")).
+		WithArgs(user.ID, user.Name, user.Email, sqlmock.AnyArg())
+	if insertErr != nil {
+		insert.WillReturnError(insertErr)
+		mock.ExpectRollback()
+		return
+	}
+	insert.WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_tokens (user_id, token, created_at) VALUES ($1, $2, $3)")).
+		WithArgs(user.ID, generateToken(user.ID), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestCreateUserWithTokenRetry(t *testing.T) {
+	user := User{ID: "id-1", Name: "John", Email: "john@example.com"}
+	serializationErr := &pq.Error{Code: pqSerializationFailure}
+
+	t.Run("succeeds after a serialization failure", func(t *testing.T) {
+		mock := useMockDB(t)
+		expectCreateUserWithToken(mock, user, serializationErr)
+		expectCreateUserWithToken(mock, user, nil)
+
+		if err := CreateUserWithTokenRetry(context.Background(), user, 3, time.Millisecond); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rolls back every attempt and gives up", func(t *testing.T) {
+		mock := useMockDB(t)
+		expectCreateUserWithToken(mock, user, serializationErr)
+		expectCreateUserWithToken(mock, user, serializationErr)
+
+		err := CreateUserWithTokenRetry(context.Background(), user, 2, time.Millisecond)
+		if !errors.Is(err, serializationErr) {
+			t.Fatalf("expected the serialization failure, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		mock := useMockDB(t)
+		uniqueErr := &pq.Error{Code: "23505"}
+		expectCreateUserWithToken(mock, user, uniqueErr)
+
+		err := CreateUserWithTokenRetry(context.Background(), user, 3, time.Millisecond)
+		if !errors.Is(err, uniqueErr) {
+			t.Fatalf("expected the unique violation, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestRetryPolicy_Jitter(t *testing.T) {
+	policy := RetryPolicy{Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := policy.jitter(100 * time.Millisecond); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("jittered delay %v outside [50ms, 100ms]", got)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Event is a domain event raised while a transaction is running.
+type Event struct {
+	Name    string
+	Payload any
+}
+
+// EventPublisher delivers events once the transaction that raised them has committed.
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// ErrNoTxEventCollector is returned when an event is registered outside of WithTx.
+var ErrNoTxEventCollector = errors.New("no transaction event collector in context")
+
+// TxEventCollector buffers events raised during a transaction.
+// They are flushed to the publisher on commit and discarded on rollback.
+type TxEventCollector struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Add buffers an event until the transaction commits.
+func (c *TxEventCollector) Add(event Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+// Events returns a copy of the buffered events in registration order.
+func (c *TxEventCollector) Events() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.events...)
+}
+
+func (c *TxEventCollector) flush(ctx context.Context, publisher EventPublisher) error {
+	for _, event := range c.Events() {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return fmt.Errorf("failed to publish event %s: %w", event.Name, err)
+		}
+	}
+	return nil
+}
+
+type txEventCollectorKey struct{}
+
+// TxEventCollectorFromContext returns the collector stored by WithTx, if any.
+func TxEventCollectorFromContext(ctx context.Context) (*TxEventCollector, bool) {
+	c, ok := ctx.Value(txEventCollectorKey{}).(*TxEventCollector)
+	return c, ok
+}
+
+// RegisterEvent buffers an event on the collector of the surrounding WithTx call.
+func RegisterEvent(ctx context.Context, event Event) error {
+	c, ok := TxEventCollectorFromContext(ctx)
+	if !ok {
+		return ErrNoTxEventCollector
+	}
+	c.Add(event)
+	return nil
+}
+
+// WithTx runs fn inside a transaction. Events registered through the context
+// passed to fn are published, in order, only after the transaction commits.
+func WithTx(ctx context.Context, db *sqlx.DB, publisher EventPublisher, fn func(ctx context.Context, tx *sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	collector := &TxEventCollector{}
+	err = fn(context.WithValue(ctx, txEventCollectorKey{}, collector), tx)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if publisher == nil {
+		return nil
+	}
+	// the transaction is already committed, so the deferred rollback is a no-op
+	// if publishing fails; the error is still surfaced to the caller
+	return collector.flush(ctx, publisher)
+}
+
+// WithReadTx runs fn inside a read-only transaction, so the database rejects any write
+// fn attempts. The transaction is also repeatable read, so every statement in fn reads
+// the same snapshot, e.g. a list of rows and their count agree.
+func WithReadTx(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context, tx *sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin read-only transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(ctx, tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit read-only transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+type recordingPublisher struct {
+	events []Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event Event) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	return sqlx.NewDb(mockDB, "postgres"), mock
+}
+
+// useMockDB points the package level db at a sqlmock for the duration of the test.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	mockDB, mock := newMockDB(t)
+	prev := db
+	db = mockDB
+	t.Cleanup(func() { db = prev })
+	return mock
+}
+
+func TestWithTx_RollbackDiscardsEvents(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	publisher := &recordingPublisher{}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	errBoom := errors.New("boom")
+	err := WithTx(context.Background(), sqlxDB, publisher, func(ctx context.Context, tx *sqlx.Tx) error {
+		if err := RegisterEvent(ctx, Event{Name: "user.created"}); err != nil {
+			return err
+		}
+		if err := RegisterEvent(ctx, Event{Name: "token.created"}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected %v, got %v", errBoom, err)
+	}
+	if len(publisher.events) != 0 {
+		t.Fatalf("expected no events published, got %v", publisher.events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTx_CommitPublishesEventsInOrder(t *testing.T) {
+	sqlxDB, mock := newMockDB(t)
+	publisher := &recordingPublisher{}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err := WithTx(context.Background(), sqlxDB, publisher, func(ctx context.Context, tx *sqlx.Tx) error {
+		if err := RegisterEvent(ctx, Event{Name: "user.created"}); err != nil {
+			return err
+		}
+		return RegisterEvent(ctx, Event{Name: "token.created"})
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(publisher.events) != 2 {
+		t.Fatalf("expected 2 events published, got %d", len(publisher.events))
+	}
+	if publisher.events[0].Name != "user.created" || publisher.events[1].Name != "token.created" {
+		t.Fatalf("events published out of order: %v", publisher.events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterEvent_OutsideTx(t *testing.T) {
+	if err := RegisterEvent(context.Background(), Event{Name: "orphan"}); !errors.Is(err, ErrNoTxEventCollector) {
+		t.Fatalf("expected ErrNoTxEventCollector, got %v", err)
+	}
+}
+
+// readOnlyConn is a driver connection recording the options of the transactions it
+// begins and rejecting writes inside read-only ones, like PostgreSQL does.
+type readOnlyConn struct {
+	txOpts     []driver.TxOptions
+	inReadOnly bool
+	commits    int
+	rollbacks  int
+}
+
+func (c *readOnlyConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *readOnlyConn) Close() error { return nil }
+
+func (c *readOnlyConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *readOnlyConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.txOpts = append(c.txOpts, opts)
+	c.inReadOnly = opts.ReadOnly
+	return readOnlyTx{c}, nil
+}
+
+func (c *readOnlyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.inReadOnly {
+		verb, _, _ := strings.Cut(query, " ")
+		return nil, fmt.Errorf("pq: cannot execute %s in a read-only transaction", verb)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type readOnlyTx struct{ conn *readOnlyConn }
+
+func (tx readOnlyTx) Commit() error {
+	tx.conn.inReadOnly = false
+	tx.conn.commits++
+	return nil
+}
+
+func (tx readOnlyTx) Rollback() error {
+	tx.conn.inReadOnly = false
+	tx.conn.rollbacks++
+	return nil
+}
+
+type readOnlyConnector struct{ conn *readOnlyConn }
+
+func (c readOnlyConnector) Connect(context.Context) (driver.Conn, error) { return c.conn, nil }
+
+func (c readOnlyConnector) Driver() driver.Driver { return c }
+
+func (c readOnlyConnector) Open(string) (driver.Conn, error) { return c.conn, nil }
+
+func newReadOnlyDB(t *testing.T) (*sqlx.DB, *readOnlyConn) {
+	t.Helper()
+	conn := &readOnlyConn{}
+	sqlDB := sql.OpenDB(readOnlyConnector{conn})
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return sqlx.NewDb(sqlDB, "postgres"), conn
+}
+
+func TestWithReadTx_OpensReadOnlyTransaction(t *testing.T) {
+	sqlxDB, conn := newReadOnlyDB(t)
+
+	err := WithReadTx(context.Background(), sqlxDB, func(ctx context.Context, tx *sqlx.Tx) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []driver.TxOptions{{Isolation: driver.IsolationLevel(sql.LevelRepeatableRead), ReadOnly: true}}
+	if !slices.Equal(conn.txOpts, want) {
+		t.Fatalf("expected transactions %+v, got %+v", want, conn.txOpts)
+	}
+	if conn.commits != 1 || conn.rollbacks != 0 {
+		t.Fatalf("expected a commit, got %d commits and %d rollbacks", conn.commits, conn.rollbacks)
+	}
+}
+
+func TestWithReadTx_WriteFailsAndRollsBack(t *testing.T) {
+	sqlxDB, conn := newReadOnlyDB(t)
+
+	err := WithReadTx(context.Background(), sqlxDB, func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (name) VALUES ($1)", "Alice")
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot execute INSERT in a read-only transaction") {
+		t.Fatalf("expected the write to be rejected, got %v", err)
+	}
+	if conn.commits != 0 || conn.rollbacks != 1 {
+		t.Fatalf("expected a rollback, got %d commits and %d rollbacks", conn.commits, conn.rollbacks)
+	}
+}
+
+func TestCreateUserWithToken_CancelledContextRollsBack(t *testing.T) {
+	mock := useMockDB(t)
+	user := User{ID: "id-1", Name: "John", Email: "john@example.com"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	err := CreateUserWithToken(ctx, user)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	waitExpectations(t, mock)
+}
+
+func TestCreateUserWithToken_TxTimeout(t *testing.T) {
+	mock := useMockDB(t)
+	prev := TxTimeout
+	TxTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { TxTimeout = prev })
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	err := CreateUserWithToken(context.Background(), User{ID: "id-1", Name: "John", Email: "john@example.com"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	waitExpectations(t, mock)
+}
+
+// waitExpectations waits for mock's expectations to be met. database/sql rolls back a
+// transaction whose context is done from a background goroutine, so the rollback may
+// reach the driver after the call under test returned.
+func waitExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := mock.ExpectationsWereMet()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCreateUserWithToken_CommitErrorReleasesConnection(t *testing.T) {
+	mock := useMockDB(t)
+	user := User{ID: "id-1", Name: "John", Email: "john@example.com"}
+	errCommit := errors.New("connection lost during commit")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO user_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(errCommit)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	err := CreateUserWithToken(context.Background(), user)
+	if !errors.Is(err, errCommit) {
+		t.Fatalf("expected the commit error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Fatalf("expected the connection to be released, %d still in use", inUse)
+	}
+	// the rollback after a failed commit finds the transaction done, which is not worth logging
+	if logs.Len() != 0 {
+		t.Fatalf("expected nothing to be logged, got %q", logs.String())
+	}
+}
+
+func TestCreateUserWithToken_LogsRollbackError(t *testing.T) {
+	mock := useMockDB(t)
+	user := User{ID: "id-1", Name: "John", Email: "john@example.com"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").WillReturnError(errors.New("duplicate key value"))
+	mock.ExpectRollback().WillReturnError(errors.New("connection reset"))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	if err := CreateUserWithToken(context.Background(), user); err == nil {
+		t.Fatal("expected the insert error")
+	}
+	if !strings.Contains(logs.String(), "failed to rollback transaction: connection reset") {
+		t.Fatalf("expected the rollback error to be logged, got %q", logs.String())
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Fatalf("expected the connection to be released, %d still in use", inUse)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetUserWithTokens(t *testing.T) {
+	columns := []string{"id", "name", "email", "token"}
+
+	t.Run("groups tokens", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery(`LEFT JOIN user_tokens ut ON u\.id = ut\.user_id\s+WHERE u\.id = \$1`).
+			WithArgs("a").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("a", "Alice", "alice@example.com", "token-1").
+				AddRow("a", "Alice", "alice@example.com", "token-2"))
+
+		user, tokens, err := GetUserWithTokens(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if *user != (User{ID: "a", Name: "Alice", Email: "alice@example.com"}) {
+			t.Errorf("unexpected user: %+v", user)
+		}
+		if !slices.Equal(tokens, []string{"token-1", "token-2"}) {
+			t.Errorf("expected both tokens, got %v", tokens)
+		}
+	})
+
+	t.Run("user without tokens", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery("FROM users u").
+			WithArgs("a").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("a", "Alice", "alice@example.com", nil))
+
+		user, tokens, err := GetUserWithTokens(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user.ID != "a" {
+			t.Errorf("unexpected user: %+v", user)
+		}
+		if tokens == nil || len(tokens) != 0 {
+			t.Errorf("expected an empty token slice, got %#v", tokens)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery("FROM users u").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		user, tokens, err := GetUserWithTokens(context.Background(), "missing")
+		if !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+		if user != nil || tokens != nil {
+			t.Errorf("expected no user and tokens, got %+v %v", user, tokens)
+		}
+	})
+}
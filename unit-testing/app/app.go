@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/infras"
+	"github.com/azka-zaydan/article-materials/unit-testing/user/repository"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// Dependency names used in DependencyError.
+const (
+	DependencyConfig     = "config"
+	DependencyPostgres   = "postgres"
+	DependencyRedis      = "redis"
+	DependencyMigrations = "migrations"
+	DependencySchema     = "schema"
+)
+
+// Config holds everything Startup needs to bring the service up.
+type Config struct {
+	DB    infras.DBConfig
+	Redis infras.RedisConfig
+	// Migrations are SQL statements run in order once the database is reachable.
+	Migrations []string
+}
+
+// DefaultConfig returns the local development configuration.
+func DefaultConfig() Config {
+	return Config{
+		DB:    infras.DefaultDBConfig(),
+		Redis: infras.DefaultRedisConfig(),
+	}
+}
+
+func (c Config) validate() error {
+	var errs []error
+	if c.DB.Host == "" {
+		errs = append(errs, errors.New("database host is required"))
+	}
+	if c.DB.DBName == "" {
+		errs = append(errs, errors.New("database name is required"))
+	}
+	if err := c.DB.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Redis.Addr == "" && len(c.Redis.Addrs) == 0 {
+		errs = append(errs, errors.New("redis address is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// DependencyError reports a dependency that did not become healthy during Startup.
+type DependencyError struct {
+	Name string
+	Err  error
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *DependencyError) Unwrap() error {
+	return e.Err
+}
+
+// App is a service whose dependencies are all connected and healthy.
+type App struct {
+	DB    *sqlx.DB
+	Redis redis.UniversalClient
+}
+
+// Startup validates cfg, connects to Postgres and Redis, runs the migrations and verifies
+// the schema matches the models, returning the App only once all of them succeeded.
+// Postgres and Redis are both tried so the error names every unhealthy dependency, each
+// wrapped in a DependencyError.
+func Startup(ctx context.Context, cfg Config) (*App, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, startupError(&DependencyError{Name: DependencyConfig, Err: err})
+	}
+
+	app := &App{}
+	var errs []error
+
+	db, err := infras.ConnectDB(ctx, cfg.DB)
+	if err != nil {
+		errs = append(errs, &DependencyError{Name: DependencyPostgres, Err: err})
+	}
+	app.DB = db
+
+	rdb, err := infras.ConnectRedis(ctx, cfg.Redis)
+	if err != nil {
+		errs = append(errs, &DependencyError{Name: DependencyRedis, Err: err})
+	}
+	app.Redis = rdb
+
+	if len(errs) > 0 {
+		app.Close()
+		return nil, startupError(errs...)
+	}
+
+	for i, migration := range cfg.Migrations {
+		if _, err := app.DB.ExecContext(ctx, migration); err != nil {
+			app.Close()
+			return nil, startupError(&DependencyError{
+				Name: DependencyMigrations,
+				Err:  fmt.Errorf("migration %d failed: %w", i+1, err),
+			})
+		}
+	}
+
+	if err := repository.VerifySchema(ctx, app.DB); err != nil {
+		app.Close()
+		return nil, startupError(&DependencyError{Name: DependencySchema, Err: err})
+	}
+
+	return app, nil
+}
+
+func startupError(errs ...error) error {
+	return fmt.Errorf("startup failed: %w", errors.Join(errs...))
+}
+
+// Close releases the connections that were opened.
+func (a *App) Close() error {
+	var errs []error
+	if a.DB != nil {
+		errs = append(errs, a.DB.Close())
+	}
+	if a.Redis != nil {
+		errs = append(errs, a.Redis.Close())
+	}
+	return errors.Join(errs...)
+}
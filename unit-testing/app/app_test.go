@@ -0,0 +1,101 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/azka-zaydan/article-materials/unit-testing/app"
+	"github.com/azka-zaydan/article-materials/unit-testing/infras"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closedAddr returns a local address nothing listens on.
+func closedAddr(t *testing.T) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().(*net.TCPAddr)
+	require.NoError(t, ln.Close())
+	return addr.IP.String(), addr.Port
+}
+
+func dependencyNames(err error) []string {
+	var names []string
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return names
+	}
+	for _, e := range joined.Unwrap() {
+		var depErr *app.DependencyError
+		if errors.As(e, &depErr) {
+			names = append(names, depErr.Name)
+		}
+	}
+	return names
+}
+
+func TestStartup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("unreachable postgres", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		host, port := closedAddr(t)
+
+		cfg := app.DefaultConfig()
+		cfg.DB.Host, cfg.DB.Port = host, port
+		cfg.Redis.Addr = mr.Addr()
+
+		a, err := app.Startup(ctx, cfg)
+
+		assert.Nil(t, a)
+		require.Error(t, err)
+		assert.Equal(t, []string{app.DependencyPostgres}, dependencyNames(err))
+		assert.Contains(t, err.Error(), "postgres: failed to connect to database")
+	})
+
+	t.Run("unreachable postgres and redis", func(t *testing.T) {
+		host, port := closedAddr(t)
+		redisHost, redisPort := closedAddr(t)
+
+		cfg := app.DefaultConfig()
+		cfg.DB.Host, cfg.DB.Port = host, port
+		cfg.Redis.Addr = net.JoinHostPort(redisHost, fmt.Sprint(redisPort))
+
+		_, err := app.Startup(ctx, cfg)
+
+		require.Error(t, err)
+		assert.Equal(t, []string{app.DependencyPostgres, app.DependencyRedis}, dependencyNames(err))
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		cfg := app.DefaultConfig()
+		cfg.Redis.Addr = ""
+
+		_, err := app.Startup(ctx, cfg)
+
+		var depErr *app.DependencyError
+		require.ErrorAs(t, err, &depErr)
+		assert.Equal(t, app.DependencyConfig, depErr.Name)
+		assert.Contains(t, err.Error(), "redis address is required")
+	})
+
+	t.Run("unencrypted database in production", func(t *testing.T) {
+		cfg := app.DefaultConfig()
+		cfg.DB.Env = infras.EnvProduction
+		cfg.DB.SSLMode = infras.SSLModeDisable
+
+		_, err := app.Startup(ctx, cfg)
+
+		var depErr *app.DependencyError
+		require.ErrorAs(t, err, &depErr)
+		assert.Equal(t, app.DependencyConfig, depErr.Name)
+		assert.Contains(t, err.Error(), "sslmode disable is not allowed in production")
+	})
+}
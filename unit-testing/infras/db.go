@@ -1,8 +1,12 @@
 package infras
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -16,29 +20,243 @@ const (
 	user     = "user"
 	password = "password"
 	dbname   = "test"
+	appName  = "unit-testing"
 )
 
+// Environments a DBConfig can be deployed to. Env decides the default SSLMode.
+const (
+	EnvLocal      = "local"
+	EnvProduction = "production"
+)
+
+// SSL modes supported by DBConfig.SSLMode.
+const (
+	SSLModeDisable    = "disable"
+	SSLModeRequire    = "require"
+	SSLModeVerifyFull = "verify-full"
+)
+
+// DBConfig holds the settings used to build the PostgreSQL connection string.
+type DBConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+	// AppName is reported as application_name so queries can be attributed
+	// to this service in pg_stat_activity.
+	AppName string
+
+	// Env is the environment the service runs in, e.g. EnvLocal or EnvProduction.
+	Env string
+	// SSLMode is one of SSLModeDisable, SSLModeRequire or SSLModeVerifyFull. Empty
+	// defaults to disable in the local environment and require anywhere else.
+	SSLMode string
+	// SSLRootCert is the CA certificate the server certificate is verified against.
+	SSLRootCert string
+	// SSLCert and SSLKey are the client certificate and its key, both or neither are set.
+	SSLCert string
+	SSLKey  string
+
+	// Pool settings, see sql.DB. DefaultDBConfig sets MaxOpenConns 10, MaxIdleConns 5,
+	// ConnMaxLifetime 5 minutes and ConnMaxIdleTime 1 minute.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime closes connections left idle that long, so the pool shrinks when
+	// traffic is low instead of keeping them until ConnMaxLifetime.
+	ConnMaxIdleTime time.Duration
+}
+
+// Pool is the part of a connection pool ConfigurePool sets, *sql.DB and *sqlx.DB implement it.
+type Pool interface {
+	SetMaxOpenConns(n int)
+	SetMaxIdleConns(n int)
+	SetConnMaxLifetime(d time.Duration)
+	SetConnMaxIdleTime(d time.Duration)
+}
+
+// DefaultDBConfig returns the local development configuration.
+func DefaultDBConfig() DBConfig {
+	return DBConfig{
+		Host:     host,
+		Port:     port,
+		User:     user,
+		Password: password,
+		DBName:   dbname,
+		AppName:  appName,
+		Env:      EnvLocal,
+
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: time.Minute,
+	}
+}
+
+// sslMode returns SSLMode, or the default of the environment when it is not set.
+func (c DBConfig) sslMode() string {
+	if c.SSLMode != "" {
+		return c.SSLMode
+	}
+	if c.Env == "" || c.Env == EnvLocal {
+		return SSLModeDisable
+	}
+	return SSLModeRequire
+}
+
+// Validate reports an unknown SSLMode, an incomplete client certificate and an
+// unencrypted connection in production.
+func (c DBConfig) Validate() error {
+	var errs []error
+	switch mode := c.sslMode(); mode {
+	case SSLModeDisable:
+		if c.Env == EnvProduction {
+			errs = append(errs, errors.New("database sslmode disable is not allowed in production"))
+		}
+	case SSLModeRequire, SSLModeVerifyFull:
+	default:
+		errs = append(errs, fmt.Errorf("unknown database sslmode %q", mode))
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		errs = append(errs, errors.New("database ssl cert and key must be set together"))
+	}
+	return errors.Join(errs...)
+}
+
+// DSN builds a key/value PostgreSQL connection string from the config.
+func (c DBConfig) DSN() string {
+	dsn := fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSNValue(c.Host), c.Port, quoteDSNValue(c.User), quoteDSNValue(c.Password), quoteDSNValue(c.DBName), c.sslMode(),
+	)
+	if c.SSLRootCert != "" {
+		dsn += " sslrootcert=" + quoteDSNValue(c.SSLRootCert)
+	}
+	if c.SSLCert != "" {
+		dsn += " sslcert=" + quoteDSNValue(c.SSLCert) + " sslkey=" + quoteDSNValue(c.SSLKey)
+	}
+	if c.AppName != "" {
+		dsn += " application_name=" + quoteDSNValue(c.AppName)
+	}
+	return dsn
+}
+
+// quoteDSNValue quotes values containing spaces or quotes, as required by the key/value DSN format.
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
 // DB instance
 var DB *sqlx.DB
 
 func InitDB() error {
-	// PostgreSQL connection string
-	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname,
-	)
+	return InitDBWithConfig(DefaultDBConfig())
+}
 
+func InitDBWithConfig(cfg DBConfig) error {
 	var err error
-	DB, err = sqlx.Connect("postgres", dsn)
+	DB, err = ConnectDB(context.Background(), cfg)
+	return err
+}
+
+// ErrDBNotInitialized is returned by PingContext before InitDB.
+var ErrDBNotInitialized = errors.New("database is not initialized")
+
+// PingContext checks the connection to DB is alive, e.g. for a health check.
+func PingContext(ctx context.Context) error {
+	if DB == nil {
+		return ErrDBNotInitialized
+	}
+	if err := DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// Stats returns the pool statistics of DB, zero before InitDB.
+func Stats() sql.DBStats {
+	if DB == nil {
+		return sql.DBStats{}
+	}
+	return DB.Stats()
+}
+
+// ConnectDB opens and pings a connection pool for cfg without touching the package level DB.
+func ConnectDB(ctx context.Context, cfg DBConfig) (*sqlx.DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+
+	db, err := sqlx.ConnectContext(ctx, "postgres", cfg.DSN())
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Set connection settings
-	DB.SetMaxOpenConns(10)
-	DB.SetMaxIdleConns(5)
-	DB.SetConnMaxLifetime(time.Minute * 5)
+	cfg.ConfigurePool(db)
 
 	log.Println("Connected to PostgreSQL successfully!")
-	return nil
+	return db, nil
+}
+
+// ConfigurePool applies the pool settings of the config to db.
+func (c DBConfig) ConfigurePool(db Pool) {
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
+
+// ReadWriteDB routes writes to the primary and reads to a read replica. Without a replica
+// Read is the same pool as Write.
+type ReadWriteDB struct {
+	Write *sqlx.DB
+	Read  *sqlx.DB
+}
+
+// NewReadWriteDB pairs the write and read pools, a nil read falls back to write.
+func NewReadWriteDB(write, read *sqlx.DB) *ReadWriteDB {
+	if read == nil {
+		read = write
+	}
+	return &ReadWriteDB{Write: write, Read: read}
+}
+
+// InitReadWriteDB connects to the local development database, which has no read replica.
+func InitReadWriteDB() (*ReadWriteDB, error) {
+	return ConnectReadWriteDB(context.Background(), DefaultDBConfig(), DBConfig{})
+}
+
+// ConnectReadWriteDB connects to the primary of write and the replica of read, each with
+// its own pool settings. A read config without Host means there is no replica, reads then
+// use the write pool.
+func ConnectReadWriteDB(ctx context.Context, write, read DBConfig) (*ReadWriteDB, error) {
+	writeDB, err := ConnectDB(ctx, write)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to write database: %w", err)
+	}
+	if read.Host == "" {
+		return NewReadWriteDB(writeDB, nil), nil
+	}
+
+	readDB, err := ConnectDB(ctx, read)
+	if err != nil {
+		writeDB.Close()
+		return nil, fmt.Errorf("failed to connect to read database: %w", err)
+	}
+	return NewReadWriteDB(writeDB, readDB), nil
+}
+
+// Close closes both pools, the shared one only once when there is no replica.
+func (db *ReadWriteDB) Close() error {
+	err := db.Write.Close()
+	if db.Read != db.Write {
+		err = errors.Join(err, db.Read.Close())
+	}
+	return err
 }
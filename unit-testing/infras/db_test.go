@@ -0,0 +1,216 @@
+package infras_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/azka-zaydan/article-materials/unit-testing/infras"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBConfig_DSN(t *testing.T) {
+	t.Run("application name", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.AppName = "user-service"
+
+		assert.Contains(t, cfg.DSN(), " application_name=user-service")
+	})
+
+	t.Run("application name with spaces is quoted", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.AppName = "user service"
+
+		assert.Contains(t, cfg.DSN(), " application_name='user service'")
+	})
+
+	t.Run("empty application name is omitted", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.AppName = ""
+
+		assert.NotContains(t, cfg.DSN(), "application_name")
+	})
+}
+
+func TestDBConfig_SSLMode(t *testing.T) {
+	t.Run("local defaults to disable", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+
+		assert.Contains(t, cfg.DSN(), " sslmode=disable")
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("other environments default to require", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.Env = infras.EnvProduction
+
+		assert.Contains(t, cfg.DSN(), " sslmode=require")
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("verify-full with certificates", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.Env = infras.EnvProduction
+		cfg.SSLMode = infras.SSLModeVerifyFull
+		cfg.SSLRootCert = "/etc/ssl/ca.pem"
+		cfg.SSLCert = "/etc/ssl/client.pem"
+		cfg.SSLKey = "/etc/ssl/client.key"
+
+		dsn := cfg.DSN()
+		assert.Contains(t, dsn, " sslmode=verify-full")
+		assert.Contains(t, dsn, " sslrootcert=/etc/ssl/ca.pem")
+		assert.Contains(t, dsn, " sslcert=/etc/ssl/client.pem sslkey=/etc/ssl/client.key")
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("production rejects disable", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.Env = infras.EnvProduction
+		cfg.SSLMode = infras.SSLModeDisable
+
+		assert.EqualError(t, cfg.Validate(), "database sslmode disable is not allowed in production")
+	})
+
+	t.Run("unknown sslmode", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.SSLMode = "prefer"
+
+		assert.EqualError(t, cfg.Validate(), `unknown database sslmode "prefer"`)
+	})
+
+	t.Run("cert without key", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.SSLMode = infras.SSLModeRequire
+		cfg.SSLCert = "/etc/ssl/client.pem"
+
+		assert.EqualError(t, cfg.Validate(), "database ssl cert and key must be set together")
+	})
+}
+
+// recordingPool records the settings ConfigurePool applies.
+type recordingPool struct {
+	maxOpen, maxIdle         int
+	maxLifetime, maxIdleTime time.Duration
+}
+
+func (p *recordingPool) SetMaxOpenConns(n int)              { p.maxOpen = n }
+func (p *recordingPool) SetMaxIdleConns(n int)              { p.maxIdle = n }
+func (p *recordingPool) SetConnMaxLifetime(d time.Duration) { p.maxLifetime = d }
+func (p *recordingPool) SetConnMaxIdleTime(d time.Duration) { p.maxIdleTime = d }
+
+func TestDBConfig_ConfigurePool(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		pool := &recordingPool{}
+
+		infras.DefaultDBConfig().ConfigurePool(pool)
+
+		assert.Equal(t, &recordingPool{
+			maxOpen:     10,
+			maxIdle:     5,
+			maxLifetime: 5 * time.Minute,
+			maxIdleTime: time.Minute,
+		}, pool)
+	})
+
+	t.Run("idle time", func(t *testing.T) {
+		cfg := infras.DefaultDBConfig()
+		cfg.ConnMaxIdleTime = 30 * time.Second
+		pool := &recordingPool{}
+
+		cfg.ConfigurePool(pool)
+
+		assert.Equal(t, 30*time.Second, pool.maxIdleTime)
+	})
+}
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestReadWriteDB(t *testing.T) {
+	t.Run("reads fall back to the write pool", func(t *testing.T) {
+		write, mock := newMockDB(t)
+		mock.ExpectClose()
+
+		rw := infras.NewReadWriteDB(write, nil)
+
+		assert.Same(t, write, rw.Write)
+		assert.Same(t, write, rw.Read)
+		assert.NoError(t, rw.Close())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("replica", func(t *testing.T) {
+		write, writeMock := newMockDB(t)
+		read, readMock := newMockDB(t)
+		writeMock.ExpectClose()
+		readMock.ExpectClose()
+
+		rw := infras.NewReadWriteDB(write, read)
+
+		assert.Same(t, write, rw.Write)
+		assert.Same(t, read, rw.Read)
+		assert.NoError(t, rw.Close())
+		assert.NoError(t, writeMock.ExpectationsWereMet())
+		assert.NoError(t, readMock.ExpectationsWereMet())
+	})
+}
+
+func TestConnectReadWriteDB_WriteUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().(*net.TCPAddr)
+	require.NoError(t, ln.Close())
+
+	cfg := infras.DefaultDBConfig()
+	cfg.Host, cfg.Port = addr.IP.String(), addr.Port
+
+	rw, err := infras.ConnectReadWriteDB(context.Background(), cfg, infras.DBConfig{})
+
+	assert.Nil(t, rw)
+	assert.ErrorContains(t, err, "failed to connect to write database")
+}
+
+// useDB points infras.DB at db for the duration of the test.
+func useDB(t *testing.T, db *sqlx.DB) {
+	t.Helper()
+	prev := infras.DB
+	infras.DB = db
+	t.Cleanup(func() { infras.DB = prev })
+}
+
+func TestPingContext(t *testing.T) {
+	t.Run("alive", func(t *testing.T) {
+		db, _ := newMockDB(t)
+		db.SetMaxOpenConns(7)
+		useDB(t, db)
+
+		assert.NoError(t, infras.PingContext(context.Background()))
+		assert.Equal(t, 7, infras.Stats().MaxOpenConnections)
+	})
+
+	t.Run("closed database", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+		useDB(t, db)
+
+		err := infras.PingContext(context.Background())
+
+		assert.EqualError(t, err, "failed to ping database: sql: database is closed")
+	})
+
+	t.Run("not initialized", func(t *testing.T) {
+		useDB(t, nil)
+
+		assert.ErrorIs(t, infras.PingContext(context.Background()), infras.ErrDBNotInitialized)
+		assert.Zero(t, infras.Stats())
+	})
+}
@@ -0,0 +1,79 @@
+package infras
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig holds the settings used to connect to Redis.
+type RedisConfig struct {
+	Addr string
+	// Addrs are the seed nodes of a Redis Cluster, listing more than one connects to a cluster.
+	Addrs []string
+	// Cluster connects to a Redis Cluster even through a single address.
+	Cluster  bool
+	Password string
+	// DB is ignored by Redis Cluster, which only has database 0.
+	DB int
+}
+
+func (c RedisConfig) addrs() []string {
+	if len(c.Addrs) > 0 {
+		return c.Addrs
+	}
+	if c.Addr == "" {
+		return nil
+	}
+	return []string{c.Addr}
+}
+
+// IsCluster reports whether cfg describes a Redis Cluster rather than a single server.
+func (c RedisConfig) IsCluster() bool {
+	return c.Cluster || len(c.addrs()) > 1
+}
+
+// DefaultRedisConfig returns the local development configuration.
+func DefaultRedisConfig() RedisConfig {
+	return RedisConfig{
+		Addr: "localhost:6379",
+	}
+}
+
+// NewRedisClient creates a cluster client if cfg describes a Redis Cluster and a single
+// server client otherwise, without connecting yet. Code using Redis should accept the
+// returned redis.UniversalClient so it runs against both.
+func NewRedisClient(cfg RedisConfig) redis.UniversalClient {
+	if cfg.IsCluster() {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    cfg.addrs(),
+			Password: cfg.Password,
+		})
+	}
+
+	// cfg may give its single address in Addrs rather than Addr
+	var addr string
+	if addrs := cfg.addrs(); len(addrs) > 0 {
+		addr = addrs[0]
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+}
+
+// ConnectRedis creates a client for cfg and pings it, so an unreachable server fails here.
+func ConnectRedis(ctx context.Context, cfg RedisConfig) (redis.UniversalClient, error) {
+	rdb := NewRedisClient(cfg)
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	log.Println("Connected to Redis successfully!")
+	return rdb, nil
+}
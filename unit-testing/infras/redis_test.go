@@ -0,0 +1,55 @@
+package infras_test
+
+import (
+	"testing"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/infras"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRedisClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         infras.RedisConfig
+		wantCluster bool
+		wantAddr    string
+	}{
+		{
+			name:     "single address",
+			cfg:      infras.RedisConfig{Addr: "localhost:6379"},
+			wantAddr: "localhost:6379",
+		},
+		{
+			name:     "single entry in addresses",
+			cfg:      infras.RedisConfig{Addrs: []string{"redis-1:6379"}},
+			wantAddr: "redis-1:6379",
+		},
+		{
+			name:        "several addresses",
+			cfg:         infras.RedisConfig{Addrs: []string{"redis-1:6379", "redis-2:6379", "redis-3:6379"}},
+			wantCluster: true,
+		},
+		{
+			name:        "cluster flag",
+			cfg:         infras.RedisConfig{Addr: "redis-cluster:6379", Cluster: true},
+			wantCluster: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := infras.NewRedisClient(tt.cfg)
+			t.Cleanup(func() { rdb.Close() })
+
+			assert.Equal(t, tt.wantCluster, tt.cfg.IsCluster())
+			if tt.wantCluster {
+				assert.IsType(t, &redis.ClusterClient{}, rdb)
+			} else {
+				if assert.IsType(t, &redis.Client{}, rdb) {
+					assert.Equal(t, tt.wantAddr, rdb.(*redis.Client).Options().Addr)
+				}
+			}
+		})
+	}
+}
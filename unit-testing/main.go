@@ -1,10 +1,15 @@
 package main
 
-import "github.com/azka-zaydan/article-materials/unit-testing/infras"
+import (
+	"context"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/app"
+)
 
 func main() {
-	err := infras.InitDB()
+	a, err := app.Startup(context.Background(), app.DefaultConfig())
 	if err != nil {
 		panic(err)
 	}
+	defer a.Close()
 }
@@ -0,0 +1,45 @@
+// Package testsupport holds setup helpers for tests. They fail the test through
+// t.Fatalf instead of panicking, and register cleanup for what they create.
+package testsupport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/infras"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// Must returns v, failing the test if err is not nil.
+func Must[T any](t testing.TB, v T, err error) T {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return v
+}
+
+// MustConnect connects to the database of cfg and closes it when the test ends.
+func MustConnect(t testing.TB, cfg infras.DBConfig) *sqlx.DB {
+	t.Helper()
+	db, err := infras.ConnectDB(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+		return nil
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// MustRedis connects to the Redis server of cfg and closes the client when the test ends.
+func MustRedis(t testing.TB, cfg infras.RedisConfig) redis.UniversalClient {
+	t.Helper()
+	rdb, err := infras.ConnectRedis(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to connect to redis: %v", err)
+		return nil
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
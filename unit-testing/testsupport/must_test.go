@@ -0,0 +1,110 @@
+package testsupport_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/azka-zaydan/article-materials/unit-testing/infras"
+	"github.com/azka-zaydan/article-materials/unit-testing/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTB records fatal failures and cleanups instead of acting on them. Unlike a real
+// testing.T, Fatalf does not stop the calling goroutine.
+type fakeTB struct {
+	testing.TB
+	fatals   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatalf(format string, args ...any) {
+	f.fatals = append(f.fatals, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) runCleanups() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+// closedAddr returns a local address nothing listens on.
+func closedAddr(t *testing.T) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().(*net.TCPAddr)
+	require.NoError(t, ln.Close())
+	return addr.IP.String(), addr.Port
+}
+
+func TestMust(t *testing.T) {
+	t.Run("error fails the test", func(t *testing.T) {
+		tb := &fakeTB{TB: t}
+
+		got := testsupport.Must(tb, 0, errors.New("boom"))
+
+		assert.Zero(t, got)
+		require.Len(t, tb.fatals, 1)
+		assert.Contains(t, tb.fatals[0], "boom")
+	})
+
+	t.Run("value is returned", func(t *testing.T) {
+		tb := &fakeTB{TB: t}
+
+		assert.Equal(t, 42, testsupport.Must(tb, 42, nil))
+		assert.Empty(t, tb.fatals)
+	})
+}
+
+func TestMustRedis(t *testing.T) {
+	t.Run("success registers cleanup", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		tb := &fakeTB{TB: t}
+
+		rdb := testsupport.MustRedis(tb, infras.RedisConfig{Addr: mr.Addr()})
+
+		require.NotNil(t, rdb)
+		assert.Empty(t, tb.fatals)
+		require.Len(t, tb.cleanups, 1)
+
+		tb.runCleanups()
+		assert.Error(t, rdb.Ping(context.Background()).Err(), "client should be closed by the cleanup")
+	})
+
+	t.Run("setup error fails the test", func(t *testing.T) {
+		host, port := closedAddr(t)
+		tb := &fakeTB{TB: t}
+
+		rdb := testsupport.MustRedis(tb, infras.RedisConfig{Addr: net.JoinHostPort(host, fmt.Sprint(port))})
+
+		assert.Nil(t, rdb)
+		require.Len(t, tb.fatals, 1)
+		assert.Contains(t, tb.fatals[0], "failed to connect to redis")
+		assert.Empty(t, tb.cleanups)
+	})
+}
+
+func TestMustConnect_SetupError(t *testing.T) {
+	host, port := closedAddr(t)
+	cfg := infras.DefaultDBConfig()
+	cfg.Host, cfg.Port = host, port
+	tb := &fakeTB{TB: t}
+
+	db := testsupport.MustConnect(tb, cfg)
+
+	assert.Nil(t, db)
+	require.Len(t, tb.fatals, 1)
+	assert.Contains(t, tb.fatals[0], "failed to connect to database")
+	assert.Empty(t, tb.cleanups)
+}
@@ -10,6 +10,8 @@
 package mocks
 
 import (
+	context "context"
+	iter "iter"
 	reflect "reflect"
 
 	model "github.com/azka-zaydan/article-materials/unit-testing/user/model"
@@ -54,34 +56,48 @@ func (mr *MockUserRepositoryMockRecorder) CreateUser(user any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserRepository)(nil).CreateUser), user)
 }
 
+// DeleteUser mocks base method.
+func (m *MockUserRepository) DeleteUser(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserRepositoryMockRecorder) DeleteUser(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserRepository)(nil).DeleteUser), id)
+}
+
 // DoesUserExist mocks base method.
-func (m *MockUserRepository) DoesUserExist(email string) (bool, error) {
+func (m *MockUserRepository) DoesUserExist(tenantID int, email string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DoesUserExist", email)
+	ret := m.ctrl.Call(m, "DoesUserExist", tenantID, email)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DoesUserExist indicates an expected call of DoesUserExist.
-func (mr *MockUserRepositoryMockRecorder) DoesUserExist(email any) *gomock.Call {
+func (mr *MockUserRepositoryMockRecorder) DoesUserExist(tenantID, email any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DoesUserExist", reflect.TypeOf((*MockUserRepository)(nil).DoesUserExist), email)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DoesUserExist", reflect.TypeOf((*MockUserRepository)(nil).DoesUserExist), tenantID, email)
 }
 
 // FindUserByEmail mocks base method.
-func (m *MockUserRepository) FindUserByEmail(email string) (model.User, error) {
+func (m *MockUserRepository) FindUserByEmail(tenantID int, email string) (model.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindUserByEmail", email)
+	ret := m.ctrl.Call(m, "FindUserByEmail", tenantID, email)
 	ret0, _ := ret[0].(model.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindUserByEmail indicates an expected call of FindUserByEmail.
-func (mr *MockUserRepositoryMockRecorder) FindUserByEmail(email any) *gomock.Call {
+func (mr *MockUserRepositoryMockRecorder) FindUserByEmail(tenantID, email any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByEmail", reflect.TypeOf((*MockUserRepository)(nil).FindUserByEmail), email)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByEmail", reflect.TypeOf((*MockUserRepository)(nil).FindUserByEmail), tenantID, email)
 }
 
 // FindUserByID mocks base method.
@@ -98,3 +114,46 @@ func (mr *MockUserRepositoryMockRecorder) FindUserByID(id any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByID", reflect.TypeOf((*MockUserRepository)(nil).FindUserByID), id)
 }
+
+// IterUsers mocks base method.
+func (m *MockUserRepository) IterUsers(ctx context.Context) iter.Seq2[model.User, error] {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IterUsers", ctx)
+	ret0, _ := ret[0].(iter.Seq2[model.User, error])
+	return ret0
+}
+
+// IterUsers indicates an expected call of IterUsers.
+func (mr *MockUserRepositoryMockRecorder) IterUsers(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IterUsers", reflect.TypeOf((*MockUserRepository)(nil).IterUsers), ctx)
+}
+
+// UpdateUser mocks base method.
+func (m *MockUserRepository) UpdateUser(user *model.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockUserRepositoryMockRecorder) UpdateUser(user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockUserRepository)(nil).UpdateUser), user)
+}
+
+// UpdateUserEmail mocks base method.
+func (m *MockUserRepository) UpdateUserEmail(ctx context.Context, id int, email string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserEmail", ctx, id, email)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUserEmail indicates an expected call of UpdateUserEmail.
+func (mr *MockUserRepositoryMockRecorder) UpdateUserEmail(ctx, id, email any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserEmail", reflect.TypeOf((*MockUserRepository)(nil).UpdateUserEmail), ctx, id, email)
+}
@@ -10,6 +10,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	model "github.com/azka-zaydan/article-materials/unit-testing/user/model"
@@ -41,6 +42,20 @@ func (m *MockUserService) EXPECT() *MockUserServiceMockRecorder {
 	return m.recorder
 }
 
+// ChangeEmail mocks base method.
+func (m *MockUserService) ChangeEmail(ctx context.Context, userID int, newEmail string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeEmail", ctx, userID, newEmail)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeEmail indicates an expected call of ChangeEmail.
+func (mr *MockUserServiceMockRecorder) ChangeEmail(ctx, userID, newEmail any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeEmail", reflect.TypeOf((*MockUserService)(nil).ChangeEmail), ctx, userID, newEmail)
+}
+
 // CreateUser mocks base method.
 func (m *MockUserService) CreateUser(req dto.CreateUserReq) error {
 	m.ctrl.T.Helper()
@@ -55,19 +70,33 @@ func (mr *MockUserServiceMockRecorder) CreateUser(req any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserService)(nil).CreateUser), req)
 }
 
+// DeleteUser mocks base method.
+func (m *MockUserService) DeleteUser(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserServiceMockRecorder) DeleteUser(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserService)(nil).DeleteUser), id)
+}
+
 // GetUserByEmail mocks base method.
-func (m *MockUserService) GetUserByEmail(email string) (model.User, error) {
+func (m *MockUserService) GetUserByEmail(tenantID int, email string) (model.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserByEmail", email)
+	ret := m.ctrl.Call(m, "GetUserByEmail", tenantID, email)
 	ret0, _ := ret[0].(model.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserByEmail indicates an expected call of GetUserByEmail.
-func (mr *MockUserServiceMockRecorder) GetUserByEmail(email any) *gomock.Call {
+func (mr *MockUserServiceMockRecorder) GetUserByEmail(tenantID, email any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserService)(nil).GetUserByEmail), email)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserService)(nil).GetUserByEmail), tenantID, email)
 }
 
 // GetUserByID mocks base method.
@@ -84,3 +113,96 @@ func (mr *MockUserServiceMockRecorder) GetUserByID(id any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockUserService)(nil).GetUserByID), id)
 }
+
+// GetUserByIDWithFallback mocks base method.
+func (m *MockUserService) GetUserByIDWithFallback(id int) (model.User, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByIDWithFallback", id)
+	ret0, _ := ret[0].(model.User)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetUserByIDWithFallback indicates an expected call of GetUserByIDWithFallback.
+func (mr *MockUserServiceMockRecorder) GetUserByIDWithFallback(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByIDWithFallback", reflect.TypeOf((*MockUserService)(nil).GetUserByIDWithFallback), id)
+}
+
+// UpdateUser mocks base method.
+func (m *MockUserService) UpdateUser(user *model.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockUserServiceMockRecorder) UpdateUser(user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockUserService)(nil).UpdateUser), user)
+}
+
+// MockUserCache is a mock of UserCache interface.
+type MockUserCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserCacheMockRecorder
+	isgomock struct{}
+}
+
+// MockUserCacheMockRecorder is the mock recorder for MockUserCache.
+type MockUserCacheMockRecorder struct {
+	mock *MockUserCache
+}
+
+// NewMockUserCache creates a new mock instance.
+func NewMockUserCache(ctrl *gomock.Controller) *MockUserCache {
+	mock := &MockUserCache{ctrl: ctrl}
+	mock.recorder = &MockUserCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserCache) EXPECT() *MockUserCacheMockRecorder {
+	return m.recorder
+}
+
+// DeleteUser mocks base method.
+func (m *MockUserCache) DeleteUser(id int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DeleteUser", id)
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserCacheMockRecorder) DeleteUser(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserCache)(nil).DeleteUser), id)
+}
+
+// GetUser mocks base method.
+func (m *MockUserCache) GetUser(id int) (model.User, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", id)
+	ret0, _ := ret[0].(model.User)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockUserCacheMockRecorder) GetUser(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserCache)(nil).GetUser), id)
+}
+
+// SetUser mocks base method.
+func (m *MockUserCache) SetUser(user model.User) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetUser", user)
+}
+
+// SetUser indicates an expected call of SetUser.
+func (mr *MockUserCacheMockRecorder) SetUser(user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUser", reflect.TypeOf((*MockUserCache)(nil).SetUser), user)
+}
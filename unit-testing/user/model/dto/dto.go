@@ -1,6 +1,100 @@
 package dto
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
+)
+
 type CreateUserReq struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	TenantID int    `json:"tenant_id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+}
+
+// ErrEmptyBatch is returned by CreateUsersReq.Validate for a batch without users.
+var ErrEmptyBatch = errors.New("batch has no users")
+
+// CreateUsersReq creates several users at once.
+type CreateUsersReq struct {
+	Users []CreateUserReq `json:"users"`
+	// SkipExisting skips users whose email is already registered instead of failing the batch.
+	SkipExisting bool `json:"skip_existing"`
+}
+
+// DuplicateEmailError reports an email used by more than one user of a batch.
+type DuplicateEmailError struct {
+	TenantID int
+	Email    string
+	// Indexes are the positions of every user in the batch using Email.
+	Indexes []int
+}
+
+func (e *DuplicateEmailError) Error() string {
+	indexes := make([]string, len(e.Indexes))
+	for i, index := range e.Indexes {
+		indexes[i] = fmt.Sprint(index)
+	}
+	return fmt.Sprintf("email %s is used by users %s", e.Email, strings.Join(indexes, ", "))
+}
+
+// Validate checks the batch as a whole. It returns ErrEmptyBatch for an empty batch, and
+// a DuplicateEmailError for every email used more than once within the same tenant,
+// joined in the order the emails first appear. Emails are compared case insensitively.
+func (r CreateUsersReq) Validate() error {
+	if len(r.Users) == 0 {
+		return ErrEmptyBatch
+	}
+
+	type tenantEmail struct {
+		tenantID int
+		email    string
+	}
+	var order []tenantEmail
+	indexes := make(map[tenantEmail][]int)
+	for i, user := range r.Users {
+		key := tenantEmail{user.TenantID, strings.ToLower(strings.TrimSpace(user.Email))}
+		if _, ok := indexes[key]; !ok {
+			order = append(order, key)
+		}
+		indexes[key] = append(indexes[key], i)
+	}
+
+	var errs []error
+	for _, key := range order {
+		if len(indexes[key]) > 1 {
+			errs = append(errs, &DuplicateEmailError{TenantID: key.tenantID, Email: key.email, Indexes: indexes[key]})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TokenResp describes a user token to clients. The raw token value is only
+// included in the response to the request that created it.
+type TokenResp struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// RawToken is only set by NewCreatedTokenResp.
+	RawToken string `json:"raw_token,omitempty"`
+}
+
+// NewTokenResp builds the response for an existing token, without its raw value.
+func NewTokenResp(token model.UserToken) TokenResp {
+	return TokenResp{
+		ID:        token.ID,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}
+}
+
+// NewCreatedTokenResp builds the response for a token that was just created,
+// the only time its raw value is returned.
+func NewCreatedTokenResp(token model.UserToken) TokenResp {
+	resp := NewTokenResp(token)
+	resp.RawToken = token.Token
+	return resp
 }
@@ -0,0 +1,79 @@
+package dto_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
+	"github.com/azka-zaydan/article-materials/unit-testing/user/model/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenResp(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	token := model.UserToken{
+		ID:        7,
+		UserID:    1,
+		Token:     "s3cr3t-token-value",
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(24 * time.Hour),
+	}
+
+	t.Run("existing token omits the raw value", func(t *testing.T) {
+		body, err := json.Marshal(dto.NewTokenResp(token))
+		require.NoError(t, err)
+
+		assert.NotContains(t, string(body), token.Token)
+		assert.NotContains(t, string(body), "raw_token")
+		assert.JSONEq(t, `{"id":7,"created_at":"2024-01-02T03:04:05Z","expires_at":"2024-01-03T03:04:05Z"}`, string(body))
+	})
+
+	t.Run("created token includes the raw value once", func(t *testing.T) {
+		body, err := json.Marshal(dto.NewCreatedTokenResp(token))
+		require.NoError(t, err)
+
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(body, &resp))
+		assert.Equal(t, token.Token, resp["raw_token"])
+		assert.EqualValues(t, 7, resp["id"])
+	})
+}
+
+func TestCreateUsersReq_Validate(t *testing.T) {
+	t.Run("duplicate emails in the batch", func(t *testing.T) {
+		req := dto.CreateUsersReq{Users: []dto.CreateUserReq{
+			{Name: "John", Email: "john@example.com"},
+			{Name: "Jane", Email: "jane@example.com"},
+			{Name: "Johnny", Email: "John@Example.com"},
+			// the same email in another tenant is not a duplicate
+			{TenantID: 2, Name: "John", Email: "john@example.com"},
+		}}
+
+		err := req.Validate()
+
+		var dupErr *dto.DuplicateEmailError
+		require.True(t, errors.As(err, &dupErr))
+		assert.Equal(t, "john@example.com", dupErr.Email)
+		assert.Equal(t, []int{0, 2}, dupErr.Indexes)
+		assert.EqualError(t, err, "email john@example.com is used by users 0, 2")
+	})
+
+	t.Run("valid batch", func(t *testing.T) {
+		req := dto.CreateUsersReq{
+			Users: []dto.CreateUserReq{
+				{Name: "John", Email: "john@example.com"},
+				{Name: "Jane", Email: "jane@example.com"},
+			},
+			SkipExisting: true,
+		}
+
+		assert.NoError(t, req.Validate())
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		assert.ErrorIs(t, dto.CreateUsersReq{}.Validate(), dto.ErrEmptyBatch)
+	})
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+type UserToken struct {
+	ID        int
+	UserID    int `db:"user_id"`
+	Token     string
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
@@ -1,7 +1,12 @@
 package model
 
+import "time"
+
 type User struct {
-	ID    int
-	Name  string
-	Email string
+	ID int
+	// TenantID scopes email uniqueness, single tenant deployments leave it 0.
+	TenantID  int `db:"tenant_id"`
+	Name      string
+	Email     string
+	CreatedAt time.Time `db:"created_at"`
 }
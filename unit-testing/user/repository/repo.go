@@ -1,6 +1,11 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+
 	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
 	"github.com/jmoiron/sqlx"
 )
@@ -9,13 +14,25 @@ import (
 
 type UserRepository interface {
 	FindUserByID(id int) (res model.User, err error)
-	FindUserByEmail(email string) (res model.User, err error)
+	FindUserByEmail(tenantID int, email string) (res model.User, err error)
 	CreateUser(user *model.User) (err error)
-	DoesUserExist(email string) (exist bool, err error)
+	DoesUserExist(tenantID int, email string) (exist bool, err error)
+	UpdateUserEmail(ctx context.Context, id int, email string) (affected int64, err error)
+	UpdateUser(user *model.User) (err error)
+	DeleteUser(id int) (err error)
+	IterUsers(ctx context.Context) iter.Seq2[model.User, error]
 }
 
+// ErrUserNotFound is returned by writes that matched no user. It wraps sql.ErrNoRows,
+// so callers handle it the same way as a read that found nothing.
+var ErrUserNotFound = fmt.Errorf("user not found: %w", sql.ErrNoRows)
+
 type UserRepositoryImpl struct {
+	// DB runs the queries, which are written with ? placeholders and rebound to the ones
+	// of its driver, e.g. $1 for lib/pq.
 	DB *sqlx.DB
+	// QueryTags controls the trace comment appended to every query.
+	QueryTags QueryTagging
 }
 
 func NewUserRepository(db *sqlx.DB) UserRepository {
@@ -24,26 +41,112 @@ func NewUserRepository(db *sqlx.DB) UserRepository {
 	}
 }
 
+// userColumns lists the columns scanned into model.User. Selecting them explicitly
+// instead of SELECT * keeps scans working when new columns are added to the table.
+const userColumns = "id, tenant_id, name, email, created_at"
+
 func (r *UserRepositoryImpl) FindUserByID(id int) (res model.User, err error) {
-	err = r.DB.Get(&res, "SELECT * FROM users WHERE id = ?", id)
+	query := r.QueryTags.Tag(context.Background(), "FindUserByID", r.DB.Rebind("SELECT "+userColumns+" FROM users WHERE id = ?"))
+	err = r.DB.Get(&res, query, id)
 	return
 }
 
-func (r *UserRepositoryImpl) FindUserByEmail(email string) (res model.User, err error) {
-	err = r.DB.Get(&res, "SELECT * FROM users WHERE email = ?", email)
+// FindUserByEmail looks email up within the tenant, the same email can belong to a
+// different user in every tenant.
+func (r *UserRepositoryImpl) FindUserByEmail(tenantID int, email string) (res model.User, err error) {
+	query := r.QueryTags.Tag(context.Background(), "FindUserByEmail", r.DB.Rebind("SELECT "+userColumns+" FROM users WHERE email = ? AND tenant_id = ?"))
+	err = r.DB.Get(&res, query, email, tenantID)
 	return
 }
 
 func (r *UserRepositoryImpl) CreateUser(user *model.User) (err error) {
-	_, err = r.DB.Exec("INSERT INTO users (name, email) VALUES (?, ?)", user.Name, user.Email)
+	// created_at is filled in by the database, read it back so the caller's struct carries it
+	query := r.QueryTags.Tag(context.Background(), "CreateUser", r.DB.Rebind("INSERT INTO users (tenant_id, name, email) VALUES (?, ?, ?) RETURNING created_at"))
+	err = r.DB.QueryRowx(query, user.TenantID, user.Name, user.Email).Scan(&user.CreatedAt)
 	return
 }
 
-func (r *UserRepositoryImpl) DoesUserExist(email string) (exist bool, err error) {
+// DoesUserExist reports whether email is taken within the tenant, emails are unique per tenant.
+func (r *UserRepositoryImpl) DoesUserExist(tenantID int, email string) (exist bool, err error) {
 	var count int
-	err = r.DB.Get(&count, "SELECT COUNT(*) FROM users WHERE email = ?", email)
+	query := r.QueryTags.Tag(context.Background(), "DoesUserExist", r.DB.Rebind("SELECT COUNT(*) FROM users WHERE email = ? AND tenant_id = ?"))
+	err = r.DB.Get(&count, query, email, tenantID)
 	if err != nil {
 		return
 	}
 	return count > 0, nil
 }
+
+// UpdateUserEmail returns the number of updated rows, or ErrUserNotFound if no user has id.
+func (r *UserRepositoryImpl) UpdateUserEmail(ctx context.Context, id int, email string) (affected int64, err error) {
+	query := r.QueryTags.Tag(ctx, "UpdateUserEmail", r.DB.Rebind("UPDATE users SET email = ? WHERE id = ?"))
+	res, err := r.DB.ExecContext(ctx, query, email, id)
+	if err != nil {
+		return
+	}
+	return rowsAffected(res)
+}
+
+// UpdateUser updates the name and email of the user with user.ID, or returns
+// ErrUserNotFound if there is none.
+func (r *UserRepositoryImpl) UpdateUser(user *model.User) (err error) {
+	query := r.QueryTags.Tag(context.Background(), "UpdateUser", r.DB.Rebind("UPDATE users SET name = ?, email = ? WHERE id = ?"))
+	res, err := r.DB.Exec(query, user.Name, user.Email, user.ID)
+	if err != nil {
+		return
+	}
+	_, err = rowsAffected(res)
+	return
+}
+
+// DeleteUser deletes the user with id, or returns ErrUserNotFound if there is none.
+func (r *UserRepositoryImpl) DeleteUser(id int) (err error) {
+	query := r.QueryTags.Tag(context.Background(), "DeleteUser", r.DB.Rebind("DELETE FROM users WHERE id = ?"))
+	res, err := r.DB.Exec(query, id)
+	if err != nil {
+		return
+	}
+	_, err = rowsAffected(res)
+	return
+}
+
+// IterUsers streams every user, ordered by id, without loading them all into memory.
+// A query or scan error is yielded once and ends the iteration. The rows are closed
+// when the iteration ends, including when the caller breaks out of the loop early.
+func (r *UserRepositoryImpl) IterUsers(ctx context.Context) iter.Seq2[model.User, error] {
+	return func(yield func(model.User, error) bool) {
+		query := r.QueryTags.Tag(ctx, "IterUsers", r.DB.Rebind("SELECT "+userColumns+" FROM users ORDER BY id"))
+		rows, err := r.DB.QueryxContext(ctx, query)
+		if err != nil {
+			yield(model.User{}, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var user model.User
+			if err := rows.StructScan(&user); err != nil {
+				yield(model.User{}, err)
+				return
+			}
+			if !yield(user, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(model.User{}, err)
+		}
+	}
+}
+
+// rowsAffected reports the rows changed by a write, mapping zero rows to ErrUserNotFound.
+func rowsAffected(res sql.Result) (affected int64, err error) {
+	affected, err = res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return 0, ErrUserNotFound
+	}
+	return
+}
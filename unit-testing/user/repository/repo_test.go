@@ -0,0 +1,449 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
+	"github.com/azka-zaydan/article-materials/unit-testing/user/repository"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockDB(t testing.TB) (*sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDB.Close() })
+	return sqlx.NewDb(mockDB, "sqlmock"), mock
+}
+
+func TestUserRepositoryImpl_FindUserByID_SurvivesAddedColumn(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := repository.NewUserRepository(db)
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the table has gained a last_login_at column, but explicit columns only ask for what model.User has
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, tenant_id, name, email, created_at FROM users WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "name", "email", "created_at"}).AddRow(1, 2, "John", "john@example.com", createdAt))
+
+	res, err := repo.FindUserByID(1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.User{ID: 1, TenantID: 2, Name: "John", Email: "john@example.com", CreatedAt: createdAt}, res)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSelectStar_BreaksOnAddedColumn(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	// SELECT * returns every column, including ones model.User does not know about
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM users WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "last_login_at"}).
+			AddRow(1, "John", "john@example.com", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "2024-01-02"))
+
+	var res model.User
+	err := db.Get(&res, "SELECT * FROM users WHERE id = ?", 1)
+
+	assert.ErrorContains(t, err, "missing destination name last_login_at")
+}
+
+// wideColumns simulates a table that has grown well beyond what model.User needs.
+var wideColumns = []string{"id", "tenant_id", "name", "email", "created_at", "updated_at", "bio", "avatar_url", "last_login_ip"}
+
+var wideRow = []driver.Value{int64(1), int64(0), "John", "john@example.com", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "2024-01-02", "a fairly long biography", "https://example.com/a.png", "127.0.0.1"}
+
+// fakeRowsDriver answers every query with a single row: the whole wide row for
+// SELECT *, or only the leading id, tenant_id, name, email, created_at columns otherwise.
+type fakeRowsDriver struct{}
+
+func (fakeRowsDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeStmt struct{ query string }
+
+func (fakeStmt) Close() error                                    { return nil }
+func (fakeStmt) NumInput() int                                   { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "*") {
+		return &fakeRows{columns: wideColumns}, nil
+	}
+	return &fakeRows{columns: wideColumns[:5]}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	done    bool
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, wideRow)
+	return nil
+}
+
+func init() {
+	sql.Register("fakerows", fakeRowsDriver{})
+}
+
+func newFakeRowsDB(b *testing.B) *sqlx.DB {
+	b.Helper()
+	db, err := sqlx.Open("fakerows", "")
+	require.NoError(b, err)
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+func BenchmarkScan_SelectStar(b *testing.B) {
+	// SELECT * needs Unsafe to ignore the columns it has no destination for
+	db := newFakeRowsDB(b).Unsafe()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var res model.User
+		if err := db.Get(&res, "SELECT * FROM users WHERE id = ?", 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScan_ExplicitColumns(b *testing.B) {
+	repo := repository.NewUserRepository(newFakeRowsDB(b))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.FindUserByID(1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUserRepositoryImpl_QueryTags(t *testing.T) {
+	ctx := repository.ContextWithTraceID(context.Background(), "abc-123")
+
+	t.Run("enabled", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &repository.UserRepositoryImpl{
+			DB:        db,
+			QueryTags: repository.QueryTagging{Enabled: true, Service: "user"},
+		}
+
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET email = ? WHERE id = ? /* service:user op:UpdateUserEmail trace:abc-123 */")).
+			WithArgs("john@example.com", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := repo.UpdateUserEmail(ctx, 1, "john@example.com")
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &repository.UserRepositoryImpl{
+			DB:        db,
+			QueryTags: repository.QueryTagging{Enabled: false, Service: "user"},
+		}
+
+		mock.ExpectExec(`^UPDATE users SET email = \? WHERE id = \?$`).
+			WithArgs("john@example.com", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := repo.UpdateUserEmail(ctx, 1, "john@example.com")
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("values are escaped", func(t *testing.T) {
+		tagging := repository.QueryTagging{Enabled: true, Service: "user"}
+		ctx := repository.ContextWithTraceID(context.Background(), "x */ DROP TABLE users; --")
+
+		query := tagging.Tag(ctx, "FindUserByID", "SELECT 1")
+
+		assert.Equal(t, "SELECT 1 /* service:user op:FindUserByID trace:x____DROP_TABLE_users__-- */", query)
+	})
+}
+
+func TestUserRepositoryImpl_CreateUser_ReturnsCreatedAt(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := repository.NewUserRepository(db)
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (tenant_id, name, email) VALUES (?, ?, ?) RETURNING created_at")).
+		WithArgs(0, "John", "john@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+
+	user := model.User{Name: "John", Email: "john@example.com"}
+	err := repo.CreateUser(&user)
+
+	assert.NoError(t, err)
+	assert.False(t, user.CreatedAt.IsZero())
+	assert.Equal(t, createdAt, user.CreatedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepositoryImpl_CreateUser_RebindsForPostgres(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDB.Close() })
+	// lib/pq rejects ? placeholders, the query must reach it as $1, $2, ...
+	repo := repository.NewUserRepository(sqlx.NewDb(mockDB, "postgres"))
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (tenant_id, name, email) VALUES ($1, $2, $3) RETURNING created_at")).
+		WithArgs(1, "John", "john@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+
+	user := model.User{TenantID: 1, Name: "John", Email: "john@example.com"}
+	err = repo.CreateUser(&user)
+
+	assert.NoError(t, err)
+	assert.Equal(t, createdAt, user.CreatedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepositoryImpl_DoesUserExist_ScopedByTenant(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := repository.NewUserRepository(db)
+	query := regexp.QuoteMeta("SELECT COUNT(*) FROM users WHERE email = ? AND tenant_id = ?")
+
+	// john@example.com is registered in tenant 1 only
+	mock.ExpectQuery(query).
+		WithArgs("john@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(query).
+		WithArgs("john@example.com", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	exist, err := repo.DoesUserExist(1, "john@example.com")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+
+	exist, err = repo.DoesUserExist(2, "john@example.com")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepositoryImpl_FindUserByEmail_ScopedByTenant(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := repository.NewUserRepository(db)
+	query := regexp.QuoteMeta("SELECT id, tenant_id, name, email, created_at FROM users WHERE email = ? AND tenant_id = ?")
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// john@example.com is registered in tenant 1 only
+	mock.ExpectQuery(query).
+		WithArgs("john@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "name", "email", "created_at"}).AddRow(1, 1, "John", "john@example.com", createdAt))
+	mock.ExpectQuery(query).
+		WithArgs("john@example.com", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "name", "email", "created_at"}))
+
+	res, err := repo.FindUserByEmail(1, "john@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, model.User{ID: 1, TenantID: 1, Name: "John", Email: "john@example.com", CreatedAt: createdAt}, res)
+
+	_, err = repo.FindUserByEmail(2, "john@example.com")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepositoryImpl_UpdateUserEmail_RowsAffected(t *testing.T) {
+	query := regexp.QuoteMeta("UPDATE users SET email = ? WHERE id = ?")
+
+	t.Run("updated", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectExec(query).
+			WithArgs("john@example.com", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		affected, err := repo.UpdateUserEmail(context.Background(), 1, "john@example.com")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no such user", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectExec(query).
+			WithArgs("john@example.com", 42).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		affected, err := repo.UpdateUserEmail(context.Background(), 42, "john@example.com")
+
+		assert.ErrorIs(t, err, repository.ErrUserNotFound)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Zero(t, affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserRepositoryImpl_UpdateUser(t *testing.T) {
+	query := regexp.QuoteMeta("UPDATE users SET name = ?, email = ? WHERE id = ?")
+	user := &model.User{ID: 1, Name: "Johnny", Email: "johnny@example.com"}
+
+	t.Run("updated", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectExec(query).
+			WithArgs("Johnny", "johnny@example.com", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.UpdateUser(user)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no such user", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectExec(query).
+			WithArgs("Johnny", "johnny@example.com", 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.UpdateUser(user)
+
+		assert.ErrorIs(t, err, repository.ErrUserNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserRepositoryImpl_DeleteUser(t *testing.T) {
+	query := regexp.QuoteMeta("DELETE FROM users WHERE id = ?")
+
+	t.Run("deleted", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.DeleteUser(1)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no such user", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectExec(query).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.DeleteUser(42)
+
+		assert.ErrorIs(t, err, repository.ErrUserNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserRepositoryImpl_IterUsers(t *testing.T) {
+	query := regexp.QuoteMeta("SELECT id, tenant_id, name, email, created_at FROM users ORDER BY id")
+	columns := []string{"id", "tenant_id", "name", "email", "created_at"}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("yields every row", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectQuery(query).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, 1, "John", "john@example.com", createdAt).
+				AddRow(2, 1, "Jane", "jane@example.com", createdAt).
+				AddRow(3, 2, "Jim", "jim@example.com", createdAt)).
+			RowsWillBeClosed()
+
+		var ids []int
+		for user, err := range repo.IterUsers(context.Background()) {
+			require.NoError(t, err)
+			ids = append(ids, user.ID)
+		}
+
+		assert.Equal(t, []int{1, 2, 3}, ids)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("surfaces a scan error", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectQuery(query).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, 1, "John", "john@example.com", createdAt).
+				AddRow("not-an-id", 1, "Jane", "jane@example.com", createdAt).
+				AddRow(3, 2, "Jim", "jim@example.com", createdAt)).
+			RowsWillBeClosed()
+
+		var ids []int
+		var errs []error
+		for user, err := range repo.IterUsers(context.Background()) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			ids = append(ids, user.ID)
+		}
+
+		assert.Equal(t, []int{1}, ids)
+		require.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "converting driver.Value type string")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("closes rows on early break", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectQuery(query).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, 1, "John", "john@example.com", createdAt).
+				AddRow(2, 1, "Jane", "jane@example.com", createdAt)).
+			RowsWillBeClosed()
+
+		for user, err := range repo.IterUsers(context.Background()) {
+			require.NoError(t, err)
+			assert.Equal(t, 1, user.ID)
+			break
+		}
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := repository.NewUserRepository(db)
+		mock.ExpectQuery(query).WillReturnError(assert.AnError)
+
+		var errs []error
+		for _, err := range repo.IterUsers(context.Background()) {
+			errs = append(errs, err)
+		}
+
+		assert.Equal(t, []error{assert.AnError}, errs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// usersTable is the table model.User is scanned from.
+const usersTable = "users"
+
+// VerifySchema checks that the users table has a column for every field of model.User, so
+// a drift between the db tags and the table fails at startup instead of on the first scan.
+func VerifySchema(ctx context.Context, db *sqlx.DB) error {
+	var columns []string
+	query := db.Rebind("SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?")
+	if err := db.SelectContext(ctx, &columns, query, usersTable); err != nil {
+		return fmt.Errorf("failed to get %s columns: %w", usersTable, err)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("table %s does not exist", usersTable)
+	}
+
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column] = true
+	}
+
+	var missing []string
+	for _, field := range structColumns(reflect.TypeOf(model.User{})) {
+		if !existing[field.column] {
+			missing = append(missing, fmt.Sprintf("%s (%s)", field.column, field.name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("table %s is missing columns for model.User: %s", usersTable, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+type structColumn struct {
+	name   string
+	column string
+}
+
+// structColumns lists the column each exported field of t is scanned from, following the
+// sqlx defaults: the db tag, or the lowercased field name. Fields tagged db:"-" are skipped.
+func structColumns(t reflect.Type) []structColumn {
+	columns := make([]structColumn, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		column, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+		if column == "-" {
+			continue
+		}
+		if column == "" {
+			column = strings.ToLower(f.Name)
+		}
+		columns = append(columns, structColumn{name: f.Name, column: column})
+	}
+	return columns
+}
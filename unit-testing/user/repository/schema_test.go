@@ -0,0 +1,68 @@
+package repository_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/azka-zaydan/article-materials/unit-testing/user/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySchema(t *testing.T) {
+	query := regexp.QuoteMeta("SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?")
+
+	columnRows := func(columns ...string) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"column_name"})
+		for _, column := range columns {
+			rows.AddRow(column)
+		}
+		return rows
+	}
+
+	t.Run("matching schema", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		// extra columns are fine, model.User only needs its own
+		mock.ExpectQuery(query).
+			WithArgs("users").
+			WillReturnRows(columnRows("id", "tenant_id", "name", "email", "created_at", "last_login_at"))
+
+		err := repository.VerifySchema(context.Background(), db)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("missing column", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(query).
+			WithArgs("users").
+			WillReturnRows(columnRows("id", "name", "email", "created_at"))
+
+		err := repository.VerifySchema(context.Background(), db)
+
+		require.Error(t, err)
+		assert.EqualError(t, err, "table users is missing columns for model.User: tenant_id (TenantID)")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("missing table", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(query).WithArgs("users").WillReturnRows(columnRows())
+
+		err := repository.VerifySchema(context.Background(), db)
+
+		assert.EqualError(t, err, "table users does not exist")
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(query).WithArgs("users").WillReturnError(assert.AnError)
+
+		err := repository.VerifySchema(context.Background(), db)
+
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+type traceIDKey struct{}
+
+// ContextWithTraceID stores the trace id that tagged queries report.
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFromContext returns the trace id stored by ContextWithTraceID, if any.
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+// QueryTagging appends a comment such as /* service:user op:FindUserByID trace:abc */
+// to every query, so statements in the database logs can be correlated with traces.
+type QueryTagging struct {
+	Enabled bool
+	Service string
+}
+
+// Tag returns query with the tag comment appended, or query unchanged when tagging is disabled.
+func (t QueryTagging) Tag(ctx context.Context, op string, query string) string {
+	if !t.Enabled {
+		return query
+	}
+
+	var tags []string
+	for _, tag := range []struct{ name, value string }{
+		{"service", t.Service},
+		{"op", op},
+		{"trace", TraceIDFromContext(ctx)},
+	} {
+		if value := sanitizeTagValue(tag.value); value != "" {
+			tags = append(tags, tag.name+":"+value)
+		}
+	}
+	if len(tags) == 0 {
+		return query
+	}
+	return query + " /* " + strings.Join(tags, " ") + " */"
+}
+
+// sanitizeTagValue replaces anything but a small set of safe characters, so a value
+// can never close the comment or inject SQL.
+func sanitizeTagValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-' || r == '_' || r == '.':
+			return r
+		}
+		return '_'
+	}, v)
+}
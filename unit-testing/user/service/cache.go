@@ -0,0 +1,38 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
+)
+
+// MemoryUserCache is a UserCache keeping the users in memory, it never evicts them.
+type MemoryUserCache struct {
+	mu    sync.RWMutex
+	users map[int]model.User
+}
+
+func NewMemoryUserCache() *MemoryUserCache {
+	return &MemoryUserCache{
+		users: make(map[int]model.User),
+	}
+}
+
+func (c *MemoryUserCache) GetUser(id int) (user model.User, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	user, ok = c.users[id]
+	return
+}
+
+func (c *MemoryUserCache) SetUser(user model.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[user.ID] = user
+}
+
+func (c *MemoryUserCache) DeleteUser(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.users, id)
+}
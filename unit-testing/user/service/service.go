@@ -1,8 +1,10 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"net/mail"
 
 	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
 	"github.com/azka-zaydan/article-materials/unit-testing/user/model/dto"
@@ -11,14 +13,39 @@ import (
 
 //go:generate go run go.uber.org/mock/mockgen -source=./service.go -destination=../mocks/service_mock.go -package=mocks
 
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrUserExists     = errors.New("user already exist")
+	ErrInvalidEmail   = errors.New("invalid email")
+	ErrInternalServer = errors.New("internal server error")
+)
+
 type UserService interface {
 	GetUserByID(id int) (res model.User, err error)
-	GetUserByEmail(email string) (res model.User, err error)
+	GetUserByIDWithFallback(id int) (res model.User, stale bool, err error)
+	GetUserByEmail(tenantID int, email string) (res model.User, err error)
 	CreateUser(req dto.CreateUserReq) (err error)
+	ChangeEmail(ctx context.Context, userID int, newEmail string) (err error)
+	UpdateUser(user *model.User) (err error)
+	DeleteUser(id int) (err error)
+}
+
+// UserCache keeps the users last read from the database, so they can still be served
+// while it is unavailable.
+type UserCache interface {
+	GetUser(id int) (user model.User, ok bool)
+	SetUser(user model.User)
+	DeleteUser(id int)
 }
 
 type UserServiceImpl struct {
 	UserRepo repository.UserRepository
+	// Cache receives every user read by id, and is kept in step with the updates and
+	// deletes made through the service. It is optional.
+	Cache UserCache
+	// StaleOnError serves the cached user when reading it from the database fails,
+	// instead of returning ErrInternalServer. It needs Cache.
+	StaleOnError bool
 }
 
 func NewUserService(userRepo repository.UserRepository) UserService {
@@ -28,24 +55,39 @@ func NewUserService(userRepo repository.UserRepository) UserService {
 }
 
 func (s *UserServiceImpl) GetUserByID(id int) (res model.User, err error) {
+	res, _, err = s.GetUserByIDWithFallback(id)
+	return
+}
+
+// GetUserByIDWithFallback is GetUserByID, except that with StaleOnError set a database
+// failure is answered with the cached user, flagged stale. Without a cached user the
+// error is returned, and a user that does not exist is never served from the cache.
+func (s *UserServiceImpl) GetUserByIDWithFallback(id int) (res model.User, stale bool, err error) {
 	res, err = s.UserRepo.FindUserByID(id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return res, errors.New("user not found")
+			return res, false, ErrUserNotFound
 		}
-		err = errors.New("internal server error")
+		if s.StaleOnError && s.Cache != nil {
+			if cached, ok := s.Cache.GetUser(id); ok {
+				return cached, true, nil
+			}
+		}
+		err = ErrInternalServer
 		return
 	}
+
+	s.rememberUser(res)
 	return
 }
 
-func (s *UserServiceImpl) GetUserByEmail(email string) (res model.User, err error) {
-	res, err = s.UserRepo.FindUserByEmail(email)
+func (s *UserServiceImpl) GetUserByEmail(tenantID int, email string) (res model.User, err error) {
+	res, err = s.UserRepo.FindUserByEmail(tenantID, email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return res, errors.New("user not found")
+			return res, ErrUserNotFound
 		}
-		err = errors.New("internal server error")
+		err = ErrInternalServer
 		return
 	}
 	return
@@ -53,18 +95,136 @@ func (s *UserServiceImpl) GetUserByEmail(email string) (res model.User, err erro
 
 func (s *UserServiceImpl) CreateUser(req dto.CreateUserReq) (err error) {
 	user := model.User{
-		Name:  req.Name,
-		Email: req.Email,
+		TenantID: req.TenantID,
+		Name:     req.Name,
+		Email:    req.Email,
 	}
 
-	exist, err := s.UserRepo.DoesUserExist(user.Email)
+	exist, err := s.UserRepo.DoesUserExist(user.TenantID, user.Email)
 	if err != nil {
 		return
 	}
 	if exist {
-		return errors.New("user already exist")
+		return ErrUserExists
 	}
 
 	err = s.UserRepo.CreateUser(&user)
 	return
 }
+
+func (s *UserServiceImpl) ChangeEmail(ctx context.Context, userID int, newEmail string) (err error) {
+	if _, err = mail.ParseAddress(newEmail); err != nil {
+		return ErrInvalidEmail
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return
+	}
+
+	owned, err := s.checkEmailOwner(user, newEmail)
+	if err != nil {
+		return
+	}
+	// changing to the email the user already has is a no-op
+	if owned {
+		return nil
+	}
+
+	_, err = s.UserRepo.UpdateUserEmail(ctx, userID, newEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the user was deleted after it was looked up
+		s.forgetUser(userID)
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	user.Email = newEmail
+	s.rememberUser(user)
+	return
+}
+
+// UpdateUser updates the name and email of the user with user.ID. The email must be
+// valid and not used by another user of the same tenant.
+func (s *UserServiceImpl) UpdateUser(user *model.User) (err error) {
+	if _, err = mail.ParseAddress(user.Email); err != nil {
+		return ErrInvalidEmail
+	}
+
+	existing, err := s.GetUserByID(user.ID)
+	if err != nil {
+		return
+	}
+
+	if _, err = s.checkEmailOwner(existing, user.Email); err != nil {
+		return
+	}
+
+	err = s.UserRepo.UpdateUser(user)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the user was deleted after it was looked up
+		s.forgetUser(user.ID)
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	// only the name and email are written, the rest is as it was read
+	existing.Name = user.Name
+	existing.Email = user.Email
+	s.rememberUser(existing)
+	return
+}
+
+func (s *UserServiceImpl) DeleteUser(id int) (err error) {
+	if _, err = s.GetUserByID(id); err != nil {
+		return
+	}
+
+	err = s.UserRepo.DeleteUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the user was deleted after it was looked up
+		s.forgetUser(id)
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	s.forgetUser(id)
+	return
+}
+
+// rememberUser stores user in the cache, when there is one.
+func (s *UserServiceImpl) rememberUser(user model.User) {
+	if s.Cache != nil {
+		s.Cache.SetUser(user)
+	}
+}
+
+// forgetUser drops the user from the cache, when there is one, so a user that is gone
+// is not served stale.
+func (s *UserServiceImpl) forgetUser(id int) {
+	if s.Cache != nil {
+		s.Cache.DeleteUser(id)
+	}
+}
+
+// checkEmailOwner returns ErrUserExists when email belongs to another user of user's
+// tenant, and reports whether user already has it.
+func (s *UserServiceImpl) checkEmailOwner(user model.User, email string) (owned bool, err error) {
+	owner, err := s.UserRepo.FindUserByEmail(user.TenantID, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrInternalServer
+	}
+	if owner.ID != user.ID {
+		return false, ErrUserExists
+	}
+	return true, nil
+}
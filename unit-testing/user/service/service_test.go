@@ -1,12 +1,14 @@
 package service_test
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 
 	"github.com/azka-zaydan/article-materials/unit-testing/user/mocks"
 	"github.com/azka-zaydan/article-materials/unit-testing/user/model"
 	"github.com/azka-zaydan/article-materials/unit-testing/user/model/dto"
+	"github.com/azka-zaydan/article-materials/unit-testing/user/repository"
 	"github.com/azka-zaydan/article-materials/unit-testing/user/service"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
@@ -62,31 +64,32 @@ func TestUserServiceImpl_GetUserByEmail(t *testing.T) {
 	service := service.NewUserService(mockUserRepo)
 
 	userMock := model.User{
-		ID:    1,
-		Name:  "John",
-		Email: "john@example.com",
+		ID:       1,
+		TenantID: 1,
+		Name:     "John",
+		Email:    "john@example.com",
 	}
 	johnEmail := "john@example.com"
 
 	t.Run("success", func(t *testing.T) {
-		mockUserRepo.EXPECT().FindUserByEmail(johnEmail).Return(userMock, nil)
-		res, err := service.GetUserByEmail(johnEmail)
+		mockUserRepo.EXPECT().FindUserByEmail(1, johnEmail).Return(userMock, nil)
+		res, err := service.GetUserByEmail(1, johnEmail)
 
 		assert.NoError(t, err)
 		assert.Equal(t, userMock, res)
 	})
 
 	t.Run("error", func(t *testing.T) {
-		mockUserRepo.EXPECT().FindUserByEmail(johnEmail).Return(model.User{}, assert.AnError)
-		res, err := service.GetUserByEmail(johnEmail)
+		mockUserRepo.EXPECT().FindUserByEmail(1, johnEmail).Return(model.User{}, assert.AnError)
+		res, err := service.GetUserByEmail(1, johnEmail)
 
 		assert.Error(t, err)
 		assert.Equal(t, model.User{}, res)
 	})
 
 	t.Run("user not found", func(t *testing.T) {
-		mockUserRepo.EXPECT().FindUserByEmail(johnEmail).Return(model.User{}, sql.ErrNoRows)
-		res, err := service.GetUserByEmail(johnEmail)
+		mockUserRepo.EXPECT().FindUserByEmail(1, johnEmail).Return(model.User{}, sql.ErrNoRows)
+		res, err := service.GetUserByEmail(1, johnEmail)
 
 		assert.Error(t, err)
 		assert.Equal(t, model.User{}, res)
@@ -108,7 +111,7 @@ func TestUserServiceImpl_CreateUser(t *testing.T) {
 	}
 
 	t.Run("success", func(t *testing.T) {
-		mockUserRepo.EXPECT().DoesUserExist(createUserReq.Email).Return(false, nil)
+		mockUserRepo.EXPECT().DoesUserExist(createUserReq.TenantID, createUserReq.Email).Return(false, nil)
 		mockUserRepo.EXPECT().CreateUser(gomock.Any()).Return(nil)
 		err := service.CreateUser(createUserReq)
 
@@ -116,18 +119,342 @@ func TestUserServiceImpl_CreateUser(t *testing.T) {
 	})
 
 	t.Run("error", func(t *testing.T) {
-		mockUserRepo.EXPECT().DoesUserExist(createUserReq.Email).Return(false, assert.AnError)
-		mockUserRepo.EXPECT().CreateUser(gomock.Any()).Return(assert.AnError)
+		mockUserRepo.EXPECT().DoesUserExist(createUserReq.TenantID, createUserReq.Email).Return(false, assert.AnError)
 		err := service.CreateUser(createUserReq)
 
 		assert.Error(t, err)
 	})
 
 	t.Run("user already exist", func(t *testing.T) {
-		mockUserRepo.EXPECT().DoesUserExist(createUserReq.Email).Return(true, nil)
+		mockUserRepo.EXPECT().DoesUserExist(createUserReq.TenantID, createUserReq.Email).Return(true, nil)
 		err := service.CreateUser(createUserReq)
 
 		assert.Error(t, err)
 	})
 
+	t.Run("same email in another tenant", func(t *testing.T) {
+		otherTenantReq := createUserReq
+		otherTenantReq.TenantID = 2
+
+		// the email is taken in the default tenant, but the check is scoped to tenant 2
+		mockUserRepo.EXPECT().DoesUserExist(2, createUserReq.Email).Return(false, nil)
+		mockUserRepo.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(user *model.User) error {
+			assert.Equal(t, 2, user.TenantID)
+			assert.Equal(t, createUserReq.Email, user.Email)
+			return nil
+		})
+		err := service.CreateUser(otherTenantReq)
+
+		assert.NoError(t, err)
+	})
+
+}
+
+func TestUserServiceImpl_ChangeEmail(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepository(ctrl)
+
+	userService := service.NewUserService(mockUserRepo)
+
+	ctx := context.Background()
+	userMock := model.User{
+		ID:       1,
+		TenantID: 1,
+		Name:     "John",
+		Email:    "john@example.com",
+	}
+	newEmail := "johnny@example.com"
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, newEmail).Return(model.User{}, sql.ErrNoRows)
+		mockUserRepo.EXPECT().UpdateUserEmail(ctx, 1, newEmail).Return(int64(1), nil)
+		err := userService.ChangeEmail(ctx, 1, newEmail)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("email taken by another user", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, newEmail).Return(model.User{ID: 2, TenantID: 1, Email: newEmail}, nil)
+		err := userService.ChangeEmail(ctx, 1, newEmail)
+
+		assert.ErrorIs(t, err, service.ErrUserExists)
+	})
+
+	t.Run("email taken in another tenant", func(t *testing.T) {
+		// user 2 of tenant 2 has newEmail, the lookup is scoped to tenant 1 so it is not found
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, newEmail).Return(model.User{}, sql.ErrNoRows)
+		mockUserRepo.EXPECT().UpdateUserEmail(ctx, 1, newEmail).Return(int64(1), nil)
+		err := userService.ChangeEmail(ctx, 1, newEmail)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		err := userService.ChangeEmail(ctx, 1, "not-an-email")
+
+		assert.ErrorIs(t, err, service.ErrInvalidEmail)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, sql.ErrNoRows)
+		err := userService.ChangeEmail(ctx, 1, newEmail)
+
+		assert.ErrorIs(t, err, service.ErrUserNotFound)
+	})
+
+	t.Run("user deleted before the update", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, newEmail).Return(model.User{}, sql.ErrNoRows)
+		mockUserRepo.EXPECT().UpdateUserEmail(ctx, 1, newEmail).Return(int64(0), repository.ErrUserNotFound)
+		err := userService.ChangeEmail(ctx, 1, newEmail)
+
+		assert.ErrorIs(t, err, service.ErrUserNotFound)
+	})
+}
+
+func TestUserServiceImpl_UpdateUser(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepository(ctrl)
+
+	userService := service.NewUserService(mockUserRepo)
+
+	userMock := model.User{
+		ID:       1,
+		TenantID: 1,
+		Name:     "John",
+		Email:    "john@example.com",
+	}
+	update := &model.User{ID: 1, Name: "Johnny", Email: "johnny@example.com"}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, update.Email).Return(model.User{}, sql.ErrNoRows)
+		mockUserRepo.EXPECT().UpdateUser(update).Return(nil)
+		err := userService.UpdateUser(update)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("keeping the same email", func(t *testing.T) {
+		rename := &model.User{ID: 1, Name: "Johnny", Email: userMock.Email}
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, userMock.Email).Return(userMock, nil)
+		mockUserRepo.EXPECT().UpdateUser(rename).Return(nil)
+		err := userService.UpdateUser(rename)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("email taken by another user", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, update.Email).Return(model.User{ID: 2, TenantID: 1, Email: update.Email}, nil)
+		err := userService.UpdateUser(update)
+
+		assert.ErrorIs(t, err, service.ErrUserExists)
+	})
+
+	t.Run("email taken in another tenant", func(t *testing.T) {
+		// the tenant comes from the stored user, not from the update
+		otherTenant := &model.User{ID: 1, TenantID: 2, Name: "Johnny", Email: update.Email}
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, update.Email).Return(model.User{}, sql.ErrNoRows)
+		mockUserRepo.EXPECT().UpdateUser(otherTenant).Return(nil)
+		err := userService.UpdateUser(otherTenant)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		err := userService.UpdateUser(&model.User{ID: 1, Name: "Johnny", Email: "not-an-email"})
+
+		assert.ErrorIs(t, err, service.ErrInvalidEmail)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, sql.ErrNoRows)
+		err := userService.UpdateUser(update)
+
+		assert.ErrorIs(t, err, service.ErrUserNotFound)
+	})
+
+	t.Run("user deleted before the update", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, update.Email).Return(model.User{}, sql.ErrNoRows)
+		mockUserRepo.EXPECT().UpdateUser(update).Return(repository.ErrUserNotFound)
+		err := userService.UpdateUser(update)
+
+		assert.ErrorIs(t, err, service.ErrUserNotFound)
+	})
+	t.Run("updated user is not served stale", func(t *testing.T) {
+		cachedService := &service.UserServiceImpl{
+			UserRepo:     mockUserRepo,
+			Cache:        service.NewMemoryUserCache(),
+			StaleOnError: true,
+		}
+
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().FindUserByEmail(1, update.Email).Return(model.User{}, sql.ErrNoRows)
+		mockUserRepo.EXPECT().UpdateUser(update).Return(nil)
+		err := cachedService.UpdateUser(update)
+		assert.NoError(t, err)
+
+		// the database is down, the fallback must answer with the update
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, assert.AnError)
+		res, stale, err := cachedService.GetUserByIDWithFallback(1)
+
+		assert.NoError(t, err)
+		assert.True(t, stale)
+		assert.Equal(t, model.User{ID: 1, TenantID: 1, Name: update.Name, Email: update.Email}, res)
+	})
+}
+
+func TestUserServiceImpl_DeleteUser(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepository(ctrl)
+
+	userService := service.NewUserService(mockUserRepo)
+
+	userMock := model.User{
+		ID:    1,
+		Name:  "John",
+		Email: "john@example.com",
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().DeleteUser(1).Return(nil)
+		err := userService.DeleteUser(1)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, sql.ErrNoRows)
+		err := userService.DeleteUser(1)
+
+		assert.ErrorIs(t, err, service.ErrUserNotFound)
+	})
+
+	t.Run("user deleted before the delete", func(t *testing.T) {
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().DeleteUser(1).Return(repository.ErrUserNotFound)
+		err := userService.DeleteUser(1)
+
+		assert.ErrorIs(t, err, service.ErrUserNotFound)
+	})
+	t.Run("deleted user is not served stale", func(t *testing.T) {
+		cachedService := &service.UserServiceImpl{
+			UserRepo:     mockUserRepo,
+			Cache:        service.NewMemoryUserCache(),
+			StaleOnError: true,
+		}
+
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		mockUserRepo.EXPECT().DeleteUser(1).Return(nil)
+		err := cachedService.DeleteUser(1)
+		assert.NoError(t, err)
+
+		// the database is down, the deleted user must not come back from the cache
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, assert.AnError)
+		_, stale, err := cachedService.GetUserByIDWithFallback(1)
+
+		assert.ErrorIs(t, err, service.ErrInternalServer)
+		assert.False(t, stale)
+	})
+}
+
+func TestUserServiceImpl_GetUserByIDWithFallback(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepository(ctrl)
+
+	userMock := model.User{
+		ID:    1,
+		Name:  "John",
+		Email: "john@example.com",
+	}
+
+	t.Run("warm cache serves stale user", func(t *testing.T) {
+		userService := &service.UserServiceImpl{
+			UserRepo:     mockUserRepo,
+			Cache:        service.NewMemoryUserCache(),
+			StaleOnError: true,
+		}
+
+		// the first read warms the cache
+		mockUserRepo.EXPECT().FindUserByID(1).Return(userMock, nil)
+		res, stale, err := userService.GetUserByIDWithFallback(1)
+		assert.NoError(t, err)
+		assert.False(t, stale)
+		assert.Equal(t, userMock, res)
+
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, assert.AnError)
+		res, stale, err = userService.GetUserByIDWithFallback(1)
+
+		assert.NoError(t, err)
+		assert.True(t, stale)
+		assert.Equal(t, userMock, res)
+	})
+
+	t.Run("cold cache returns the error", func(t *testing.T) {
+		mockCache := mocks.NewMockUserCache(ctrl)
+		userService := &service.UserServiceImpl{
+			UserRepo:     mockUserRepo,
+			Cache:        mockCache,
+			StaleOnError: true,
+		}
+
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, assert.AnError)
+		mockCache.EXPECT().GetUser(1).Return(model.User{}, false)
+		res, stale, err := userService.GetUserByIDWithFallback(1)
+
+		assert.ErrorIs(t, err, service.ErrInternalServer)
+		assert.False(t, stale)
+		assert.Equal(t, model.User{}, res)
+	})
+
+	t.Run("fallback disabled", func(t *testing.T) {
+		cache := service.NewMemoryUserCache()
+		cache.SetUser(userMock)
+		userService := &service.UserServiceImpl{
+			UserRepo: mockUserRepo,
+			Cache:    cache,
+		}
+
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, assert.AnError)
+		_, stale, err := userService.GetUserByIDWithFallback(1)
+
+		assert.ErrorIs(t, err, service.ErrInternalServer)
+		assert.False(t, stale)
+	})
+
+	t.Run("deleted user is not served from the cache", func(t *testing.T) {
+		cache := service.NewMemoryUserCache()
+		cache.SetUser(userMock)
+		userService := &service.UserServiceImpl{
+			UserRepo:     mockUserRepo,
+			Cache:        cache,
+			StaleOnError: true,
+		}
+
+		mockUserRepo.EXPECT().FindUserByID(1).Return(model.User{}, sql.ErrNoRows)
+		_, stale, err := userService.GetUserByIDWithFallback(1)
+
+		assert.ErrorIs(t, err, service.ErrUserNotFound)
+		assert.False(t, stale)
+	})
 }